@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/blang/semver"
+	"gopkg.in/yaml.v2"
+)
+
+var checkConfig = flag.Bool(
+	"check-config", false,
+	"Do not run, check that the custom queries of query-path load, and exit non-zero if they do not.",
+)
+
+// checkVersion is the PostgreSQL version --check-config loads the custom
+// queries for, a recent one so version ranges resolve like on current servers.
+var checkVersion = semver.MustParse("18.0.0")
+
+// checkUserQueries loads the custom queries at path over the builtin maps,
+// like a scrape of a checkVersion server would, and also rejects namespaces
+// defined more than once, which loading silently merges.
+func checkUserQueries(path, priority string) (err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var namespaces yaml.MapSlice
+	if err := yaml.Unmarshal(content, &namespaces); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, item := range namespaces {
+		name := fmt.Sprint(item.Key)
+		if seen[name] {
+			return fmt.Errorf("namespace %q is defined more than once", name)
+		}
+		seen[name] = true
+	}
+
+	// addQueries assumes well-formed attributes
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed custom queries: %v", r)
+		}
+	}()
+	exporterMap := makeDescMap(checkVersion, builtinMetricMaps, descMapOptions{})
+	queryOverrideMap := makeQueryOverrideMap(checkVersion, queryOverrides)
+	return addQueries(content, checkVersion, exporterMap, queryOverrideMap, priority)
+}
@@ -0,0 +1,54 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type CheckConfigSuite struct{}
+
+var _ = Suite(&CheckConfigSuite{})
+
+func (s *CheckConfigSuite) TestCheckUserQueries(c *C) {
+	c.Check(checkUserQueries("../../queries.yaml", userQueriesReplace), IsNil)
+
+	path := filepath.Join(c.MkDir(), "queries.yaml")
+	c.Check(checkUserQueries(path, userQueriesReplace), ErrorMatches, ".*no such file or directory")
+
+	for _, t := range []struct {
+		content string
+		err     string
+	}{
+		{"jobs: [", "yaml: .*"},
+		{`
+jobs:
+  query: "SELECT 1 AS count"
+  metrics:
+    - count:
+        usage: "GAUGE"
+        description: "Jobs"
+jobs:
+  query: "SELECT 2 AS count"
+`, `namespace "jobs" is defined more than once`},
+		{`
+jobs:
+  query: "SELECT 1 AS count"
+  metrics:
+    - count:
+        usage: "GAGUE"
+        description: "Jobs"
+`, ".*GAGUE.*"},
+		{`
+jobs:
+  query: 1
+`, "malformed custom queries: .*"},
+	} {
+		c.Assert(ioutil.WriteFile(path, []byte(t.content), 0600), IsNil)
+		c.Check(checkUserQueries(path, userQueriesReplace), ErrorMatches, t.err, Commentf("%s", t.content))
+	}
+}
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"flag"
+	"sort"
+)
+
+// optionalCollector groups builtin namespaces which are not scraped unless
+// enabled with their --collect.<name> flag, usually because they are
+// expensive, high-cardinality or depend on an extension.
+type optionalCollector struct {
+	help           string
+	metricMaps     map[string]map[string]ColumnMapping
+	queryOverrides map[string][]OverrideQuery
+	// metricNames names the metrics of namespace.column which are not
+	// namespace_column, e.g. to sit next to those of another namespace
+	metricNames map[string]string
+	// averages makes the gauge of namespace.column the change of the column
+	// between scrapes divided by that of the column it maps to
+	averages map[string]string
+}
+
+var optionalCollectors = map[string]optionalCollector{
+	"stat-statements": {
+		help: "Collect per-query statistics from the pg_stat_statements extension, which must be installed in the database connected to.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_statements": {
+				"usename":          {LABEL, "Name of the user who executed the statement", nil, nil},
+				"datname":          {LABEL, "Name of the database in which the statement was executed", nil, nil},
+				"queryid":          {LABEL, "Hash code identifying the statement", nil, nil},
+				"calls":            {COUNTER, "Number of times the statement was executed", nil, nil},
+				"rows":             {COUNTER, "Total number of rows retrieved or affected by the statement", nil, nil},
+				"total_time":       {COUNTER, "Total time spent executing the statement, in milliseconds", nil, mustParseVersionRange("<13.0.0")},
+				"min_time":         {GAUGE, "Minimum time spent executing the statement, in milliseconds", nil, mustParseVersionRange("<13.0.0")},
+				"max_time":         {GAUGE, "Maximum time spent executing the statement, in milliseconds", nil, mustParseVersionRange("<13.0.0")},
+				"mean_time":        {GAUGE, "Mean time spent executing the statement, in milliseconds", nil, mustParseVersionRange("<13.0.0")},
+				"total_exec_time":  {COUNTER, "Total time spent executing the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"min_exec_time":    {GAUGE, "Minimum time spent executing the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"max_exec_time":    {GAUGE, "Maximum time spent executing the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"mean_exec_time":   {GAUGE, "Mean time spent executing the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"plans":            {COUNTER, "Number of times the statement was planned", nil, mustParseVersionRange(">=13.0.0")},
+				"total_plan_time":  {COUNTER, "Total time spent planning the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"min_plan_time":    {GAUGE, "Minimum time spent planning the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"max_plan_time":    {GAUGE, "Maximum time spent planning the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"mean_plan_time":   {GAUGE, "Mean time spent planning the statement, in milliseconds", nil, mustParseVersionRange(">=13.0.0")},
+				"shared_blks_hit":  {COUNTER, "Total number of shared block cache hits by the statement", nil, nil},
+				"shared_blks_read": {COUNTER, "Total number of shared blocks read by the statement", nil, nil},
+			},
+			// Kept apart from pg_stat_statements so stat-statements.databases
+			// and stat-statements.users do not filter the count.
+			"pg_stat_statements_totals": {
+				"statements_count": {GAUGE, "Number of statements tracked by pg_stat_statements, evicted beyond pg_stat_statements.max", nil, nil},
+				"statements_max":   {GAUGE, "Maximum number of statements tracked by pg_stat_statements, the pg_stat_statements.max setting", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_statements": {
+				{
+					mustParseVersionRange(">=13.0.0"),
+					`
+					SELECT
+						pg_get_userbyid(s.userid) AS usename,
+						d.datname,
+						s.queryid,
+						s.calls,
+						s.rows,
+						s.total_exec_time,
+						s.min_exec_time,
+						s.max_exec_time,
+						s.mean_exec_time,
+						s.plans,
+						s.total_plan_time,
+						s.min_plan_time,
+						s.max_plan_time,
+						s.mean_plan_time,
+						s.shared_blks_hit,
+						s.shared_blks_read
+					FROM pg_stat_statements s
+					JOIN pg_database d ON d.oid = s.dbid
+					`,
+				},
+				{
+					// queryid was added in 9.4
+					mustParseVersionRange(">=9.4.0 <13.0.0"),
+					`
+					SELECT
+						pg_get_userbyid(s.userid) AS usename,
+						d.datname,
+						s.queryid,
+						s.calls,
+						s.rows,
+						s.total_time,
+						s.min_time,
+						s.max_time,
+						s.mean_time,
+						s.shared_blks_hit,
+						s.shared_blks_read
+					FROM pg_stat_statements s
+					JOIN pg_database d ON d.oid = s.dbid
+					`,
+				},
+			},
+			"pg_stat_statements_totals": {
+				{
+					mustParseVersionRange(">=9.4.0"),
+					`
+					SELECT
+						count(*) AS statements_count,
+						current_setting('pg_stat_statements.max')::int AS statements_max
+					FROM pg_stat_statements
+					`,
+				},
+			},
+		},
+		metricNames: map[string]string{
+			"pg_stat_statements_totals.statements_count": "pg_stat_statements_count",
+			"pg_stat_statements_totals.statements_max":   "pg_stat_statements_max",
+		},
+	},
+	"standby-names": {
+		help: "Collect the synchronous state of each standby connected to this server.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_replication_sync": {
+				"application_name": {LABEL, "Name of the application that is connected to this WAL sender", nil, nil},
+				"sync_state":       {LABEL, "Synchronous state of this standby server", nil, nil},
+				"standby":          {GAUGE, "Always 1, one series per connected standby", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_replication_sync": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`SELECT application_name, sync_state, 1 AS standby FROM pg_stat_replication`,
+				},
+			},
+		},
+	},
+	"query-age-quantiles": {
+		help: "Collect the 0.5, 0.95 and 0.99 quantiles of the age of active queries, computed by the server.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_activity_query_age": {
+				"quantile": {LABEL, "Quantile of the age of active queries", nil, nil},
+				"seconds":  {GAUGE, "Age of active queries at the quantile, in seconds", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_activity_query_age": {
+				{
+					// percentile_cont was added in 9.4
+					mustParseVersionRange(">=9.4.0"),
+					`
+					SELECT
+						q.quantile::text AS quantile,
+						percentile_cont(q.quantile) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM now() - a.query_start)::float) AS seconds
+					FROM (VALUES (0.5), (0.95), (0.99)) AS q(quantile)
+					LEFT JOIN pg_stat_activity a ON a.state = 'active' AND a.pid <> pg_backend_pid()
+					GROUP BY q.quantile
+					`,
+				},
+			},
+		},
+	},
+	"relation-sizes": {
+		help: "Collect the size of the table, indexes and TOAST data of every user table in the database connected to.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_relation_size": {
+				"schemaname": {LABEL, "Name of the schema that this table is in", nil, nil},
+				"relname":    {LABEL, "Name of this table", nil, nil},
+				"kind":       {LABEL, "Part of the table which is measured: table, index or toast", nil, nil},
+				"bytes":      {GAUGE, "Disk space used by this part of the table, in bytes", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_relation_size": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT
+						n.nspname AS schemaname,
+						c.relname,
+						k.kind,
+						CASE k.kind
+							WHEN 'table' THEN pg_relation_size(c.oid)
+							WHEN 'index' THEN pg_indexes_size(c.oid)
+							WHEN 'toast' THEN COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0)
+						END AS bytes
+					FROM pg_class c
+					JOIN pg_namespace n ON n.oid = c.relnamespace
+					CROSS JOIN (VALUES ('table'), ('index'), ('toast')) AS k(kind)
+					WHERE c.relkind IN ('r', 'm')
+						AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+						AND n.nspname !~ '^pg_toast'
+					`,
+				},
+			},
+		},
+	},
+	"autovacuum-eligible": {
+		help: "Collect the number of tables of the database connected to whose dead tuples exceed their autovacuum threshold.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_autovacuum_eligible": {
+				"tables": {GAUGE, "Number of tables whose dead tuples exceed their autovacuum vacuum threshold", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_autovacuum_eligible": {
+				{
+					// Per-table storage parameters take precedence over the
+					// server settings. reltuples is -1 for tables which have
+					// never been analyzed on PostgreSQL 14 and up.
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT count(*) AS tables
+					FROM pg_stat_user_tables s
+					JOIN pg_class c ON c.oid = s.relid
+					WHERE s.n_dead_tup >
+						COALESCE(
+							(SELECT o.option_value::float FROM pg_options_to_table(c.reloptions) o WHERE o.option_name = 'autovacuum_vacuum_threshold'),
+							current_setting('autovacuum_vacuum_threshold')::float
+						) +
+						COALESCE(
+							(SELECT o.option_value::float FROM pg_options_to_table(c.reloptions) o WHERE o.option_name = 'autovacuum_vacuum_scale_factor'),
+							current_setting('autovacuum_vacuum_scale_factor')::float
+						) * GREATEST(c.reltuples, 0)
+					`,
+				},
+			},
+		},
+	},
+	"autovacuum-disabled-tables": {
+		help: "Collect the tables of the database connected to which have autovacuum disabled by a storage parameter.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_autovacuum_table": {
+				"schemaname": {LABEL, "Name of the schema that this table is in", nil, nil},
+				"relname":    {LABEL, "Name of this table", nil, nil},
+				"disabled":   {GAUGE, "Always 1, one series per table with autovacuum_enabled set to off", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_autovacuum_table": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT n.nspname AS schemaname, c.relname, 1 AS disabled
+					FROM pg_class c
+					JOIN pg_namespace n ON n.oid = c.relnamespace
+					WHERE c.relkind IN ('r', 'm')
+						AND EXISTS (
+							SELECT 1 FROM pg_options_to_table(c.reloptions) o
+							WHERE o.option_name = 'autovacuum_enabled' AND NOT o.option_value::bool
+						)
+					`,
+				},
+			},
+		},
+	},
+	"vacuum-blockers": {
+		help: "Collect the age of the oldest transaction snapshot held by a backend, which prevents vacuum from removing newer dead tuples cluster-wide.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_oldest_xmin": {
+				"age": {GAUGE, "Age in transactions of the oldest xmin horizon held by a backend", nil, nil},
+			},
+			"pg_autovacuum_blocked_by_xmin": {
+				"seconds": {GAUGE, "How long the transaction holding the oldest xmin horizon has been running, in seconds", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// backend_xmin was added in 9.4. The exporter's own backend is
+			// excluded since it holds a snapshot while querying.
+			"pg_oldest_xmin": {
+				{
+					mustParseVersionRange(">=9.4.0"),
+					`
+					SELECT COALESCE(max(age(backend_xmin)), 0) AS age
+					FROM pg_stat_activity
+					WHERE backend_xmin IS NOT NULL AND pid <> pg_backend_pid()
+					`,
+				},
+			},
+			"pg_autovacuum_blocked_by_xmin": {
+				{
+					mustParseVersionRange(">=9.4.0"),
+					`
+					SELECT COALESCE((
+						SELECT EXTRACT(EPOCH FROM now() - xact_start)
+						FROM pg_stat_activity
+						WHERE backend_xmin IS NOT NULL AND pid <> pg_backend_pid()
+						ORDER BY age(backend_xmin) DESC
+						LIMIT 1
+					), 0) AS seconds
+					`,
+				},
+			},
+		},
+	},
+	"lwlock-waits": {
+		help: "Collect the number of backends waiting on each lightweight lock (PostgreSQL 9.6 and up).",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_activity_lwlock": {
+				"wait_event": {LABEL, "Name of the lightweight lock waited on", nil, nil},
+				"waiters":    {GAUGE, "Number of backends waiting on this lightweight lock", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_activity_lwlock": {
+				{
+					mustParseVersionRange(">=10.0.0"),
+					`
+					SELECT wait_event, count(*) AS waiters
+					FROM pg_stat_activity
+					WHERE wait_event_type = 'LWLock'
+					GROUP BY wait_event
+					`,
+				},
+				{
+					// 9.6 split lightweight locks into two wait event types
+					mustParseVersionRange(">=9.6.0 <10.0.0"),
+					`
+					SELECT wait_event, count(*) AS waiters
+					FROM pg_stat_activity
+					WHERE wait_event_type IN ('LWLockNamed', 'LWLockTranche')
+					GROUP BY wait_event
+					`,
+				},
+			},
+		},
+	},
+	"cursors": {
+		help: "Collect a best-effort count of open SQL cursors per database, from backends whose most recent statement declared one.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_cursors": {
+				"datname": {LABEL, "Name of the database the backends are connected to", nil, nil},
+				"count":   {GAUGE, "Number of backends whose most recent statement declared a cursor", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// pg_cursors and pg_prepared_statements only show the session
+			// querying them, so other backends' cursors are estimated from
+			// their most recent statement instead.
+			"pg_cursors": {
+				{
+					mustParseVersionRange(">=9.2.0"),
+					`
+					SELECT d.datname, count(a.pid) AS count
+					FROM pg_database d
+					LEFT JOIN pg_stat_activity a ON a.datid = d.oid
+						AND a.pid <> pg_backend_pid()
+						AND a.query ~* '^\s*DECLARE\s'
+					WHERE d.datallowconn AND NOT d.datistemplate
+					GROUP BY d.datname
+					`,
+				},
+			},
+		},
+	},
+	"derived-ratios": {
+		help: "Collect ratios derived from pg_stat_bgwriter which indicate write and fsync pressure on backends, the average checkpoint write and sync time, and the rollback ratio of each database.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_bgwriter_derived": {
+				"backend_fsync_per_checkpoint": {GAUGE, "Number of fsync calls backends had to execute themselves per checkpoint since the statistics were reset, NaN before the first checkpoint", nil, nil},
+				"backend_write_ratio":          {GAUGE, "Fraction of buffers written directly by backends rather than by checkpoints or the background writer since the statistics were reset", nil, nil},
+			},
+			"pg_checkpoint": {
+				"avg_write_seconds": {GAUGE, "Average time the checkpoints since the previous scrape spent writing files to disk, in seconds, NaN if there was none", nil, nil},
+				"avg_sync_seconds":  {GAUGE, "Average time the checkpoints since the previous scrape spent synchronizing files to disk, in seconds, NaN if there was none", nil, nil},
+				"checkpoints":       {DISCARD, "Number of checkpoints the write and sync times are averaged over", nil, nil},
+			},
+			"pg_stat_database_rollback": {
+				"datname": {LABEL, "Name of this database", nil, nil},
+				"ratio":   {GAUGE, "Fraction of the transactions of this database rolled back since the statistics were reset, NaN before the first transaction", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// PostgreSQL 17 moved the checkpoint and backend columns out of
+			// pg_stat_bgwriter, they are rebuilt as for the pg_stat_bgwriter
+			// namespace.
+			"pg_stat_bgwriter_derived": {
+				{
+					mustParseVersionRange("<17.0.0"),
+					`
+					SELECT
+						buffers_backend_fsync::float / NULLIF(checkpoints_timed + checkpoints_req, 0) AS backend_fsync_per_checkpoint,
+						buffers_backend::float / NULLIF(buffers_checkpoint + buffers_clean + buffers_backend, 0) AS backend_write_ratio
+					FROM pg_stat_bgwriter
+					`,
+				},
+				{
+					mustParseVersionRange(">=17.0.0"),
+					`
+					SELECT
+						io.fsyncs::float / NULLIF(c.num_timed + c.num_requested, 0) AS backend_fsync_per_checkpoint,
+						io.writes::float / NULLIF(c.buffers_written + b.buffers_clean + io.writes, 0) AS backend_write_ratio
+					FROM pg_stat_bgwriter b
+					CROSS JOIN pg_stat_checkpointer c
+					CROSS JOIN (
+						SELECT COALESCE(sum(writes), 0) AS writes, COALESCE(sum(fsyncs), 0) AS fsyncs
+						FROM pg_stat_io
+						WHERE object = 'relation'
+							AND backend_type NOT IN ('background writer', 'checkpointer')
+					) io
+					`,
+				},
+			},
+			// The totals are averaged over the checkpoints between scrapes, see
+			// averages below. PostgreSQL 17 moved the checkpoint columns to
+			// pg_stat_checkpointer, 18 added num_done, which leaves out the
+			// checkpoints skipped since the server was idle.
+			"pg_checkpoint": {
+				{
+					mustParseVersionRange(">=9.2.0 <17.0.0"),
+					`
+					SELECT
+						checkpoint_write_time / 1000 AS avg_write_seconds,
+						checkpoint_sync_time / 1000 AS avg_sync_seconds,
+						checkpoints_timed + checkpoints_req AS checkpoints
+					FROM pg_stat_bgwriter
+					`,
+				},
+				{
+					mustParseVersionRange(">=17.0.0 <18.0.0"),
+					`
+					SELECT
+						write_time / 1000 AS avg_write_seconds,
+						sync_time / 1000 AS avg_sync_seconds,
+						num_timed + num_requested AS checkpoints
+					FROM pg_stat_checkpointer
+					`,
+				},
+				{
+					mustParseVersionRange(">=18.0.0"),
+					`
+					SELECT
+						write_time / 1000 AS avg_write_seconds,
+						sync_time / 1000 AS avg_sync_seconds,
+						num_done AS checkpoints
+					FROM pg_stat_checkpointer
+					`,
+				},
+			},
+			// The row of shared objects has no datname, and no transactions.
+			"pg_stat_database_rollback": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT
+						datname,
+						xact_rollback::float / NULLIF(xact_commit + xact_rollback, 0) AS ratio
+					FROM pg_stat_database
+					WHERE datname IS NOT NULL
+					`,
+				},
+			},
+		},
+		averages: map[string]string{
+			"pg_checkpoint.avg_write_seconds": "checkpoints",
+			"pg_checkpoint.avg_sync_seconds":  "checkpoints",
+		},
+	},
+	"activity-clients": {
+		help: "Collect the number of distinct client addresses connected to this server.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_activity_distinct": {
+				"client_addrs": {GAUGE, "Number of distinct client addresses connected over TCP", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_activity_distinct": {
+				{
+					mustParseVersionRange(">=9.2.0"),
+					`SELECT count(DISTINCT client_addr) AS client_addrs FROM pg_stat_activity`,
+				},
+			},
+		},
+	},
+	"activity-by-application": {
+		help: "Collect the number of connections per application_name and state.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_activity_by_application": {
+				"application_name": {LABEL, "Name of the application connected, unknown if it did not set one", nil, nil},
+				"state":            {LABEL, "Connection state", nil, nil},
+				"connections":      {GAUGE, "Number of connections of this application in this state", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_activity_by_application": {
+				{
+					mustParseVersionRange(">=9.2.0"),
+					`
+					SELECT
+						COALESCE(NULLIF(application_name, ''), 'unknown') AS application_name,
+						COALESCE(state, 'unknown') AS state,
+						count(*) AS connections
+					FROM pg_stat_activity
+					WHERE pid <> pg_backend_pid()
+					GROUP BY 1, 2
+					`,
+				},
+			},
+		},
+		metricNames: map[string]string{
+			"pg_stat_activity_by_application.connections": "pg_stat_activity_by_application",
+		},
+	},
+	"missing-pk": {
+		help: "Collect the number of tables without a primary key per schema of the database connected to.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_tables_without_primary_key": {
+				"schemaname": {LABEL, "Name of the schema the tables are in", nil, nil},
+				"tables":     {GAUGE, "Number of tables in this schema without a primary key", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_tables_without_primary_key": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT n.nspname AS schemaname, count(*) AS tables
+					FROM pg_class c
+					JOIN pg_namespace n ON n.oid = c.relnamespace
+					WHERE c.relkind = 'r'
+						AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+						AND n.nspname !~ '^pg_toast'
+						AND NOT EXISTS (
+							SELECT 1 FROM pg_constraint p WHERE p.conrelid = c.oid AND p.contype = 'p'
+						)
+					GROUP BY n.nspname
+					`,
+				},
+			},
+		},
+		metricNames: map[string]string{
+			"pg_tables_without_primary_key.tables": "pg_tables_without_primary_key",
+		},
+	},
+	"parallel-workers": {
+		help: "Collect the number of parallel query worker groups and workers, and the workers of each leader.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_activity_parallel": {
+				"groups":  {GAUGE, "Number of queries running with parallel workers", nil, nil},
+				"workers": {GAUGE, "Number of parallel workers running", nil, nil},
+			},
+			"pg_stat_activity_parallel_leader": {
+				"leader_pid": {LABEL, "Process ID of the leader of the parallel workers", nil, nil},
+				"workers":    {GAUGE, "Number of parallel workers of this leader", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_activity_parallel": {
+				{
+					mustParseVersionRange(">=13.0.0"),
+					`
+					SELECT count(DISTINCT leader_pid) AS groups, count(*) AS workers
+					FROM pg_stat_activity
+					WHERE leader_pid IS NOT NULL AND pid <> leader_pid
+					`,
+				},
+			},
+			"pg_stat_activity_parallel_leader": {
+				{
+					mustParseVersionRange(">=13.0.0"),
+					`
+					SELECT leader_pid::text AS leader_pid, count(*) AS workers
+					FROM pg_stat_activity
+					WHERE leader_pid IS NOT NULL AND pid <> leader_pid
+					GROUP BY leader_pid
+					`,
+				},
+			},
+		},
+	},
+	"security-events": {
+		help: "Collect security event counters, e.g. failed logins, from the table or view named by security-events.relation.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			securityEventsNamespace: {
+				"event":        {LABEL, "Security event counted", nil, nil},
+				"events_total": {COUNTER, "Number of times this security event occurred", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// The relation is replaced by security-events.relation.
+			securityEventsNamespace: {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`SELECT event::text AS event, total AS events_total FROM security_events`,
+				},
+			},
+		},
+	},
+	"per-backend": {
+		help: "Collect the transaction and query age of each backend, up to per-backend.limit backends.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_backend": {
+				"pid":               {LABEL, "Process ID of the backend", nil, nil},
+				"datname":           {LABEL, "Name of the database the backend is connected to", nil, nil},
+				"usename":           {LABEL, "Name of the user the backend is logged in as", nil, nil},
+				"xact_age_seconds":  {GAUGE, "Seconds since the current transaction of the backend started, NaN if none is open", nil, nil},
+				"query_age_seconds": {GAUGE, "Seconds since the current or last query of the backend started", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_backend": {
+				{
+					// Ordered so the limit keeps the oldest transactions.
+					mustParseVersionRange(">=9.2.0"),
+					`
+					SELECT
+						pg_stat_get_backend_pid(backendid)::text AS pid,
+						COALESCE(d.datname, '') AS datname,
+						COALESCE(r.rolname, '') AS usename,
+						EXTRACT(EPOCH FROM now() - pg_stat_get_backend_xact_start(backendid)) AS xact_age_seconds,
+						EXTRACT(EPOCH FROM now() - pg_stat_get_backend_activity_start(backendid)) AS query_age_seconds
+					FROM pg_stat_get_backend_idset() AS backendid
+					LEFT JOIN pg_database d ON d.oid = pg_stat_get_backend_dbid(backendid)
+					LEFT JOIN pg_roles r ON r.oid = pg_stat_get_backend_userid(backendid)
+					WHERE pg_stat_get_backend_pid(backendid) <> pg_backend_pid()
+					ORDER BY pg_stat_get_backend_xact_start(backendid) NULLS LAST,
+						pg_stat_get_backend_activity_start(backendid) NULLS LAST
+					`,
+				},
+			},
+		},
+	},
+	"progress-basebackup": {
+		help: "Collect the progress of each running base backup, e.g. pg_basebackup or a standby being rebuilt.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_progress_basebackup": {
+				"pid":                  {LABEL, "Process ID of the WAL sender streaming the backup", nil, nil},
+				"phase":                {LABEL, "Current processing phase of the backup", nil, nil},
+				"backup_total":         {GAUGE, "Estimated bytes to stream, NaN if estimation is disabled", nil, nil},
+				"backup_streamed":      {GAUGE, "Bytes streamed", nil, nil},
+				"tablespaces_total":    {GAUGE, "Number of tablespaces to stream", nil, nil},
+				"tablespaces_streamed": {GAUGE, "Number of tablespaces streamed", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_progress_basebackup": {
+				{
+					mustParseVersionRange(">=13.0.0"),
+					`
+					SELECT
+						pid::text AS pid,
+						phase,
+						backup_total,
+						backup_streamed,
+						tablespaces_total,
+						tablespaces_streamed
+					FROM pg_stat_progress_basebackup
+					`,
+				},
+			},
+		},
+	},
+	"temp-tables": {
+		help: "Collect the number and total size of the temporary tables of all sessions in the database connected to.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_temp_tables": {
+				"count":      {GAUGE, "Number of temporary tables in the database connected to", nil, nil},
+				"size_bytes": {GAUGE, "Total size of the temporary tables in the database connected to, including their indexes and TOAST data, in bytes", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// Temporary tables live in the pg_temp_N schema of their session.
+			"pg_temp_tables": {
+				{
+					mustParseVersionRange(">=9.1.0"),
+					`
+					SELECT
+						count(*) AS count,
+						COALESCE(sum(pg_total_relation_size(c.oid)), 0) AS size_bytes
+					FROM pg_class c
+					JOIN pg_namespace n ON n.oid = c.relnamespace
+					WHERE c.relpersistence = 't'
+						AND c.relkind IN ('r', 'p')
+						AND n.nspname LIKE 'pg\_temp\_%'
+					`,
+				},
+			},
+		},
+	},
+	"ssl": {
+		help: "Collect the number of client connections using SSL, per TLS version and cipher.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_ssl": {
+				"ssl":         {LABEL, "Whether the connection uses SSL, unknown if the connecting user may not see it", nil, nil},
+				"version":     {LABEL, "TLS version in use, empty without SSL", nil, nil},
+				"cipher":      {LABEL, "SSL cipher in use, empty without SSL", nil, nil},
+				"connections": {GAUGE, "Number of client connections with this SSL status, TLS version and cipher", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// Without pg_read_all_stats or superuser the SSL columns of the
+			// connections of other users are NULL, counted as unknown.
+			"pg_stat_ssl": {
+				{
+					// Before 10 pg_stat_activity only lists client backends.
+					mustParseVersionRange(">=9.5.0 <10.0.0"),
+					`
+					SELECT
+						CASE WHEN s.ssl IS NULL THEN 'unknown' WHEN s.ssl THEN 'true' ELSE 'false' END AS ssl,
+						COALESCE(s.version, '') AS version,
+						COALESCE(s.cipher, '') AS cipher,
+						count(*) AS connections
+					FROM pg_stat_ssl s
+					JOIN pg_stat_activity a ON a.pid = s.pid
+					GROUP BY 1, 2, 3
+					`,
+				},
+				{
+					mustParseVersionRange(">=10.0.0"),
+					`
+					SELECT
+						CASE WHEN s.ssl IS NULL THEN 'unknown' WHEN s.ssl THEN 'true' ELSE 'false' END AS ssl,
+						COALESCE(s.version, '') AS version,
+						COALESCE(s.cipher, '') AS cipher,
+						count(*) AS connections
+					FROM pg_stat_ssl s
+					JOIN pg_stat_activity a ON a.pid = s.pid
+					WHERE a.backend_type = 'client backend'
+					GROUP BY 1, 2, 3
+					`,
+				},
+			},
+		},
+	},
+	"sequence-exhaustion": {
+		help: "Collect the fraction of their range used by the sequences past sequence-exhaustion.threshold.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_sequence": {
+				"schemaname":   {LABEL, "Name of the schema of this sequence", nil, nil},
+				"sequencename": {LABEL, "Name of this sequence", nil, nil},
+				"usage_ratio":  {GAUGE, "Fraction of the range of this sequence used, it fails to produce values at 1", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			// last_value is NULL until the sequence is first used, and for
+			// sequences the user may not read. With a cache it is the last
+			// value cached, ahead of the values handed out. Cycling sequences
+			// never run out. Computed as numeric since the range of a bigint
+			// sequence overflows bigint.
+			"pg_sequence": {
+				{
+					mustParseVersionRange(">=10.0.0"),
+					`
+					SELECT
+						schemaname,
+						sequencename,
+						(CASE WHEN increment_by > 0
+							THEN last_value::numeric - min_value
+							ELSE max_value::numeric - last_value
+						END / (max_value::numeric - min_value))::float AS usage_ratio
+					FROM pg_sequences
+					WHERE last_value IS NOT NULL AND NOT cycle
+					`,
+				},
+			},
+		},
+	},
+	"user-tables": {
+		help: "Collect scan, tuple and vacuum statistics of each table in the database connected to, except those in user-tables.exclude-schemas.",
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_user_tables": {
+				"schemaname":      {LABEL, "Name of the schema that this table is in", nil, nil},
+				"relname":         {LABEL, "Name of this table", nil, nil},
+				"seq_scan":        {COUNTER, "Number of sequential scans initiated on this table", nil, nil},
+				"idx_scan":        {COUNTER, "Number of index scans initiated on this table, NaN if it has no index", nil, nil},
+				"n_tup_ins":       {COUNTER, "Number of rows inserted", nil, nil},
+				"n_tup_upd":       {COUNTER, "Number of rows updated", nil, nil},
+				"n_tup_del":       {COUNTER, "Number of rows deleted", nil, nil},
+				"n_live_tup":      {GAUGE, "Estimated number of live rows", nil, nil},
+				"n_dead_tup":      {GAUGE, "Estimated number of dead rows", nil, nil},
+				"last_vacuum":     {GAUGE, "Last time at which this table was manually vacuumed (not counting VACUUM FULL), in seconds since the epoch, NaN if never", nil, nil},
+				"last_autovacuum": {GAUGE, "Last time at which this table was vacuumed by the autovacuum daemon, in seconds since the epoch, NaN if never", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_user_tables": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT
+						schemaname,
+						relname,
+						seq_scan,
+						idx_scan,
+						n_tup_ins,
+						n_tup_upd,
+						n_tup_del,
+						n_live_tup,
+						n_dead_tup,
+						last_vacuum,
+						last_autovacuum
+					FROM pg_stat_user_tables
+					`,
+				},
+			},
+		},
+	},
+}
+
+// collectorFlags holds the --collect.<name> flag of each optional collector.
+var collectorFlags = make(map[string]*bool)
+
+func init() {
+	for name, collector := range optionalCollectors {
+		collectorFlags[name] = flag.Bool("collect."+name, false, collector.help)
+	}
+}
+
+// enabledCollectors returns the names of the optional collectors enabled by
+// flag or config file.
+func enabledCollectors() []string {
+	var names []string
+	for name, enabled := range collectorFlags {
+		if lookupConfig("collect."+name, *enabled).(bool) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectorMetricNames returns the metric names of namespace.column of all
+// the optional collectors which are not namespace_column.
+func collectorMetricNames() map[string]string {
+	names := make(map[string]string)
+	for _, collector := range optionalCollectors {
+		for k, v := range collector.metricNames {
+			names[k] = v
+		}
+	}
+	return names
+}
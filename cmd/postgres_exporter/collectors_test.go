@@ -0,0 +1,114 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type CollectorsSuite struct{}
+
+var _ = Suite(&CollectorsSuite{})
+
+// Every optional collector needs a [collect] config key so it can be enabled
+// from the config file as well.
+func (s *CollectorsSuite) TestCollectorsHaveConfigKey(c *C) {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(collectConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		keys[t.Field(i).Tag.Get("ini")] = true
+	}
+
+	for name := range optionalCollectors {
+		c.Check(keys[name], Equals, true, Commentf("collector %q has no config key", name))
+	}
+}
+
+func (s *CollectorsSuite) TestCollectorNamespacesAreUnique(c *C) {
+	seen := make(map[string]string)
+	for namespace := range builtinMetricMaps {
+		seen[namespace] = "builtin"
+	}
+
+	for name, collector := range optionalCollectors {
+		for namespace := range collector.metricMaps {
+			owner, found := seen[namespace]
+			c.Check(found, Equals, false, Commentf("namespace %q of collector %q is also defined by %s", namespace, name, owner))
+			seen[namespace] = name
+		}
+	}
+}
+
+// Fixed metric names must name an existing column of their collector.
+func (s *CollectorsSuite) TestCollectorMetricNamesHaveColumn(c *C) {
+	for name, collector := range optionalCollectors {
+		for column := range collector.metricNames {
+			i := strings.LastIndex(column, ".")
+			_, found := collector.metricMaps[column[:i]][column[i+1:]]
+			c.Check(found, Equals, true, Commentf("metric name of %q of collector %q names no column", column, name))
+		}
+	}
+}
+
+// Averaged columns and the columns they are averaged over must exist.
+func (s *CollectorsSuite) TestCollectorAveragesHaveColumns(c *C) {
+	for name, collector := range optionalCollectors {
+		for column, over := range collector.averages {
+			i := strings.LastIndex(column, ".")
+			_, found := collector.metricMaps[column[:i]][column[i+1:]]
+			c.Check(found, Equals, true, Commentf("average of %q of collector %q names no column", column, name))
+			_, found = collector.metricMaps[column[:i]][over]
+			c.Check(found, Equals, true, Commentf("average of %q of collector %q is over no column", column, name))
+		}
+	}
+}
+
+func (s *CollectorsSuite) TestCollectorMetricNames(c *C) {
+	e := NewExporter("", DisableDefaultMetrics(true), WithCollectors([]string{"stat-statements"}))
+	c.Assert(e.loadMaps(semver.MustParse("13.0.0")), IsNil)
+
+	mapping := e.metricMap["pg_stat_statements_totals"]
+	c.Check(mapping.columnMappings["statements_count"].desc.String(), Matches, `.*fqName: "pg_stat_statements_count".*`)
+	c.Check(mapping.columnMappings["statements_max"].desc.String(), Matches, `.*fqName: "pg_stat_statements_max".*`)
+	c.Check(e.metricMap["pg_stat_statements"].columnMappings["calls"].desc.String(), Matches, `.*fqName: "pg_stat_statements_calls".*`)
+}
+
+func (s *CollectorsSuite) TestActivityByApplicationMetricName(c *C) {
+	e := NewExporter("", DisableDefaultMetrics(true), WithCollectors([]string{"activity-by-application"}))
+	c.Assert(e.loadMaps(semver.MustParse("13.0.0")), IsNil)
+
+	mapping := e.metricMap["pg_stat_activity_by_application"]
+	c.Check(mapping.columnMappings["connections"].desc.String(), Matches, `.*fqName: "pg_stat_activity_by_application".*`)
+}
+
+func (s *CollectorsSuite) TestMissingPKMetricName(c *C) {
+	e := NewExporter("", DisableDefaultMetrics(true), WithCollectors([]string{"missing-pk"}))
+	c.Assert(e.loadMaps(semver.MustParse("13.0.0")), IsNil)
+
+	mapping := e.metricMap["pg_tables_without_primary_key"]
+	c.Check(mapping.columnMappings["tables"].desc.String(), Matches, `.*fqName: "pg_tables_without_primary_key".*`)
+}
+
+func (s *CollectorsSuite) TestCheckpointAverages(c *C) {
+	e := NewExporter("", DisableDefaultMetrics(true), WithCollectors([]string{"derived-ratios"}))
+	c.Assert(e.loadMaps(semver.MustParse("17.0.0")), IsNil)
+
+	mapping := e.metricMap["pg_checkpoint"]
+	c.Check(mapping.columnMappings["avg_write_seconds"].average, Equals, "checkpoints")
+	c.Check(mapping.columnMappings["avg_sync_seconds"].average, Equals, "checkpoints")
+	c.Check(mapping.columnMappings["checkpoints"].discard, Equals, true)
+}
+
+func (s *CollectorsSuite) TestDerivedRatiosPostgres17(c *C) {
+	e := NewExporter("", DisableDefaultMetrics(true), WithCollectors([]string{"derived-ratios"}))
+	for _, version := range []string{"16.0.0", "17.0.0", "18.0.0"} {
+		query, err := e.namespaceQuery("pg_stat_bgwriter_derived", semver.MustParse(version))
+		c.Assert(err, IsNil, Commentf("PostgreSQL %s", version))
+		c.Check(strings.Contains(query, "backend_fsync_per_checkpoint"), Equals, true, Commentf("PostgreSQL %s", version))
+	}
+}
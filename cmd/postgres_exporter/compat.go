@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+)
+
+// compatMode replaces builtin namespaces whose queries do not work on a
+// PostgreSQL compatible service with ones which do.
+type compatMode struct {
+	metricMaps     map[string]map[string]ColumnMapping
+	queryOverrides map[string][]OverrideQuery
+}
+
+var compatModes = map[string]compatMode{
+	"aurora": {
+		// Aurora replicas share the storage of the writer instead of
+		// streaming WAL, so pg_stat_replication and the LSN functions do not
+		// describe them. aurora_replica_status() reports their lag instead.
+		metricMaps: map[string]map[string]ColumnMapping{
+			"pg_stat_replication": {
+				"server_id":           {LABEL, "Identifier of the Aurora replica instance", nil, nil},
+				"replica_lag_seconds": {GAUGE, "Lag of this Aurora replica behind the writer, in seconds", nil, nil},
+			},
+		},
+		queryOverrides: map[string][]OverrideQuery{
+			"pg_stat_replication": {
+				{
+					mustParseVersionRange(">0.0.0"),
+					`
+					SELECT server_id, replica_lag_in_msec / 1000.0 AS replica_lag_seconds
+					FROM aurora_replica_status()
+					WHERE session_id <> 'MASTER_SESSION_ID'
+					`,
+				},
+			},
+			// Replicas do not replay WAL, and Aurora does not expose its WAL
+			// positions, statistics or control data, so no query matches and
+			// these namespaces are disabled.
+			"pg_replay_lag":           {},
+			"pg_replication_slot_lag": {},
+			"pg_logical_slot":         {},
+			"pg_wal_receiver":         {},
+			"pg_stat_wal":             {},
+			"pg_control":              {},
+		},
+	},
+}
+
+var compat = flag.String(
+	"compat", "",
+	"Adapt builtin queries to a PostgreSQL compatible service, one of: "+strings.Join(compatModeNames(), ", ")+".",
+)
+
+func compatModeNames() []string {
+	var names []string
+	for name := range compatModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
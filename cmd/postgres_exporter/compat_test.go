@@ -0,0 +1,50 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"regexp"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type CompatSuite struct{}
+
+var _ = Suite(&CompatSuite{})
+
+// Compat modes only replace builtin namespaces, they do not add new ones.
+func (s *CompatSuite) TestCompatReplacesBuiltinNamespaces(c *C) {
+	for name, mode := range compatModes {
+		for namespace := range mode.metricMaps {
+			_, found := builtinMetricMaps[namespace]
+			c.Check(found, Equals, true, Commentf("compat %q replaces unknown namespace %q", name, namespace))
+		}
+		for namespace := range mode.queryOverrides {
+			_, found := builtinMetricMaps[namespace]
+			c.Check(found, Equals, true, Commentf("compat %q overrides the query of unknown namespace %q", name, namespace))
+		}
+	}
+}
+
+// The aurora mode leaves no query calling the WAL and LSN functions or
+// reading the WAL statistics, which fail or mislead on Aurora.
+func (s *CompatSuite) TestAuroraDisablesWALQueries(c *C) {
+	wal := regexp.MustCompile(`pg_(current|last)_(wal|xlog)|pg_control_|pg_stat_wal|_lsn\(`)
+	for _, version := range []string{"11.0.0", "14.0.0", "16.0.0"} {
+		e := NewExporter("", WithCompat("aurora"))
+		c.Assert(e.loadMaps(semver.MustParse(version)), IsNil)
+
+		for namespace := range e.metricMap {
+			query, found := e.queryOverrides[namespace]
+			if !found {
+				query = defaultNamespaceQuery(namespace)
+			}
+			c.Check(wal.MatchString(query), Equals, false, Commentf("PostgreSQL %s: %s runs %s", version, namespace, query))
+		}
+		for _, namespace := range []string{"pg_replay_lag", "pg_replication_slot_lag", "pg_logical_slot", "pg_wal_receiver", "pg_stat_wal", "pg_control"} {
+			c.Check(e.queryOverrides[namespace], Equals, "", Commentf("PostgreSQL %s: %s", version, namespace))
+		}
+	}
+}
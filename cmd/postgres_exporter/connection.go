@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/prometheus/common/log"
+)
+
+// connectionParams are the keys of the [connection] config section, set as
+// the connection parameters of the same name of the DSN. They are only read
+// from the config file, keeping the paths of the certificates out of the
+// command line.
+var connectionParams = []string{"sslmode", "sslrootcert", "sslcert", "sslkey"}
+
+// addConnectionParams sets the connection parameters of the [connection]
+// config section in dsn, overriding those dsn already has.
+func addConnectionParams(dsn string) (string, error) {
+	for _, key := range connectionParams {
+		value := lookupConfig("connection."+key, "").(string)
+		if value == "" {
+			continue
+		}
+
+		existing, ok, err := getDSNParam(dsn, key)
+		if err != nil {
+			return "", err
+		}
+		if ok && existing != value {
+			log.Warnf("Overriding the %s of the datasource with the one of the [connection] config section", key)
+		}
+		if dsn, err = setDSNParam(dsn, key, value); err != nil {
+			return "", err
+		}
+	}
+	return dsn, nil
+}
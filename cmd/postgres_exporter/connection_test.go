@@ -0,0 +1,34 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ConnectionSuite struct{}
+
+var _ = Suite(&ConnectionSuite{})
+
+func (s *ConnectionSuite) TestAddConnectionParams(c *C) {
+	saved := *cfg
+	defer func() { *cfg = saved }()
+	cfg.Connection = connectionConfig{
+		SSLMode:     "verify-full",
+		SSLRootCert: "/etc/ssl/ca.pem",
+	}
+
+	dsn, err := addConnectionParams("postgresql://user@localhost:5432/postgres?sslmode=disable")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "postgresql://user@localhost:5432/postgres?sslmode=verify-full&sslrootcert=%2Fetc%2Fssl%2Fca.pem")
+
+	dsn, err = addConnectionParams("host=localhost sslmode=disable")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "host=localhost sslmode=disable sslmode='verify-full' sslrootcert='/etc/ssl/ca.pem'")
+
+	cfg.Connection = connectionConfig{}
+	dsn, err = addConnectionParams("host=localhost sslmode=disable")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "host=localhost sslmode=disable")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// openDB opens a database handle for dsn, in the URL or the key/value form.
+// The libpq keepalive parameters, which pgx would pass on to the server as
+// run-time parameters, are applied by the dialer instead, and every new
+// connection switches to role if it is set.
+func openDB(dsn, role string) (*sql.DB, error) {
+	dsn, params, err := splitKeepaliveParams(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params) > 0 {
+		dialer, err := newKeepaliveDialer(params)
+		if err != nil {
+			return nil, err
+		}
+		config.DialFunc = dialer.DialContext
+	}
+
+	var opts []stdlib.OptionOpenDB
+	if role != "" {
+		opts = append(opts, stdlib.OptionAfterConnect(func(ctx context.Context, conn *pgx.Conn) error {
+			_, err := conn.Exec(ctx, "SET ROLE "+quoteIdentifier(role))
+			return err
+		}))
+	}
+	return stdlib.OpenDB(*config, opts...), nil
+}
+
+// quoteIdentifier quotes name for use as an identifier in a query.
+func quoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	"gopkg.in/yaml.v2"
+)
+
+var dropColumns listFlag
+
+func init() {
+	flag.Var(&dropColumns, "drop-columns", "namespace.column of a builtin, collector or custom query column not to export. Repeatable, or comma separated.")
+}
+
+// parseDropColumns parses the comma separated namespace.column list of the
+// columns not to export into the columns of each namespace. Columns of the
+// namespaces in metricMaps must exist and not be labels; other namespaces
+// must be those of the custom queries at queriesPath.
+func parseDropColumns(s string, metricMaps map[string]map[string]ColumnMapping, queriesPath string) (map[string][]string, error) {
+	columns := make(map[string][]string)
+	var userNamespaces map[string]bool
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+
+		i := strings.LastIndex(column, ".")
+		if i <= 0 || i == len(column)-1 {
+			return nil, fmt.Errorf("invalid --drop-columns %q, must be namespace.column", column)
+		}
+		namespace, name := column[:i], column[i+1:]
+		if mappings, ok := metricMaps[namespace]; ok {
+			mapping, ok := mappings[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid --drop-columns %q, no such column", column)
+			}
+			if mapping.usage == LABEL {
+				return nil, fmt.Errorf("invalid --drop-columns %q, labels cannot be dropped", column)
+			}
+		} else {
+			if userNamespaces == nil {
+				var err error
+				if userNamespaces, err = userQueryNamespaces(queriesPath); err != nil {
+					return nil, fmt.Errorf("invalid --drop-columns %q, reading the custom queries failed: %s", column, err)
+				}
+			}
+			if !userNamespaces[namespace] {
+				return nil, fmt.Errorf("invalid --drop-columns %q, no such namespace", column)
+			}
+		}
+		columns[namespace] = append(columns[namespace], name)
+	}
+	return columns, nil
+}
+
+// userQueryNamespaces returns the namespaces of the custom queries at path,
+// none if path is empty.
+func userQueryNamespaces(path string) (map[string]bool, error) {
+	namespaces := make(map[string]bool)
+	if path == "" {
+		return namespaces, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		namespaces[fmt.Sprint(item.Key)] = true
+	}
+	return namespaces, nil
+}
+
+// discardColumns discards the columns of metricMap in columns, including
+// columns the namespace does not map, which would otherwise be exported as
+// untyped metrics, and SUMMARY or HISTOGRAM pseudo-columns. Label columns of
+// custom queries are kept. Namespaces missing from metricMap, e.g. those of
+// disabled collectors, were validated by parseDropColumns and are skipped.
+func discardColumns(metricMap map[string]MetricMapNamespace, columns map[string][]string) {
+	for namespace, names := range columns {
+		mapping, ok := metricMap[namespace]
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if isLabel(mapping.labels, name) {
+				log.Warnln("Not dropping label column", name, "of namespace", namespace)
+				continue
+			}
+			mapping.columnMappings[name] = MetricMap{discard: true}
+			delete(mapping.summaries, name)
+		}
+	}
+}
+
+func isLabel(labels []string, name string) bool {
+	for _, label := range labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type DropColumnsSuite struct{}
+
+var _ = Suite(&DropColumnsSuite{})
+
+func (s *DropColumnsSuite) TestParseDropColumns(c *C) {
+	path := filepath.Join(c.MkDir(), "queries.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte("pg_custom:\n  query: SELECT 1 AS value\n"), 0644), IsNil)
+
+	columns, err := parseDropColumns("pg_stat_database.deadlocks, pg_custom.value,pg_stat_database.conflicts", knownMetricMaps(""), path)
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, map[string][]string{
+		"pg_stat_database": {"deadlocks", "conflicts"},
+		"pg_custom":        {"value"},
+	})
+
+	_, err = parseDropColumns("pg_stat_database", knownMetricMaps(""), "")
+	c.Check(err, ErrorMatches, `invalid --drop-columns "pg_stat_database", must be namespace.column`)
+	_, err = parseDropColumns("pg_stat_database.unknown", knownMetricMaps(""), "")
+	c.Check(err, ErrorMatches, `.*no such column`)
+	_, err = parseDropColumns("pg_stat_database.datname", knownMetricMaps(""), "")
+	c.Check(err, ErrorMatches, `.*labels cannot be dropped`)
+	_, err = parseDropColumns("pg_custom.value", knownMetricMaps(""), "")
+	c.Check(err, ErrorMatches, `invalid --drop-columns "pg_custom.value", no such namespace`)
+	_, err = parseDropColumns("pg_missing.value", knownMetricMaps(""), path)
+	c.Check(err, ErrorMatches, `invalid --drop-columns "pg_missing.value", no such namespace`)
+	_, err = parseDropColumns("pg_custom.value", knownMetricMaps(""), filepath.Join(c.MkDir(), "missing.yaml"))
+	c.Check(err, ErrorMatches, `invalid --drop-columns "pg_custom.value", reading the custom queries failed: .*`)
+}
+
+func (s *DropColumnsSuite) TestDiscardColumns(c *C) {
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_custom": {"datname": {LABEL, "", nil, nil}, "value": {GAUGE, "", nil, nil}},
+	}
+	metricMap := makeDescMap(semver.MustParse("10.0.0"), metricMaps, descMapOptions{})
+	discardColumns(metricMap, map[string][]string{
+		"pg_custom":  {"datname", "value", "unmapped"},
+		"pg_missing": {"value"},
+	})
+
+	mapping := metricMap["pg_custom"]
+	c.Check(mapping.columnMappings["datname"].discard, Equals, true)
+	c.Check(mapping.labels, DeepEquals, []string{"datname"})
+	c.Check(mapping.columnMappings["value"].discard, Equals, true)
+	c.Check(mapping.columnMappings["unmapped"].discard, Equals, true)
+	_, ok := metricMap["pg_missing"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *DropColumnsSuite) TestDiscardSummaryColumns(c *C) {
+	content := []byte(`
+request_latency:
+  query: "SELECT p50, latency_sum, latency_count FROM latency"
+  metrics:
+    - latency:
+        usage: "SUMMARY"
+        description: "Request latency"
+        quantiles:
+          0.5: p50
+`)
+	metricMap := make(map[string]MetricMapNamespace)
+	err := addQueries(content, semver.MustParse("10.0.0"), metricMap, make(map[string]string), userQueriesReplace)
+	c.Assert(err, IsNil)
+	c.Assert(metricMap["request_latency"].summaries, HasLen, 1)
+
+	discardColumns(metricMap, map[string][]string{"request_latency": {"latency"}})
+	c.Check(metricMap["request_latency"].summaries, HasLen, 0)
+	c.Check(metricMap["request_latency"].columnMappings["latency"].discard, Equals, true)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// isURLDSN reports whether dsn is in the URL form rather than the key/value
+// form of connection strings.
+func isURLDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// getDSNParam returns the value of the connection parameter key of dsn, and
+// whether it was set at all.
+func getDSNParam(dsn, key string) (string, bool, error) {
+	if isURLDSN(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", false, err
+		}
+		values, ok := u.Query()[key]
+		if !ok || len(values) == 0 {
+			return "", false, nil
+		}
+		return values[0], true, nil
+	}
+
+	params, err := parseKeyValueDSN(dsn)
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := params[key]
+	return value, ok, nil
+}
+
+// setDSNParam sets the connection parameter key of dsn to value, replacing
+// any value it already had.
+func setDSNParam(dsn, key, value string) (string, error) {
+	if isURLDSN(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	if _, err := parseKeyValueDSN(dsn); err != nil {
+		return "", err
+	}
+	// The last occurrence of a parameter wins in the key/value form.
+	return strings.TrimSpace(dsn + " " + key + "=" + quoteDSNValue(value)), nil
+}
+
+// addDSNOptions appends command-line options, e.g. "-c application_name=foo",
+// to the options connection parameter of dsn.
+func addDSNOptions(dsn, options string) (string, error) {
+	existing, _, err := getDSNParam(dsn, "options")
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		options = existing + " " + options
+	}
+	return setDSNParam(dsn, "options", options)
+}
+
+// quoteDSNValue quotes a value for the key/value form of connection strings.
+func quoteDSNValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `'`, `\'`, -1)
+	return "'" + value + "'"
+}
+
+// parseKeyValueDSN parses a connection string in the key/value form, e.g.
+// "host=localhost user='postgres'".
+func parseKeyValueDSN(dsn string) (map[string]string, error) {
+	params := make(map[string]string)
+	r := []rune(dsn)
+
+	for i := 0; i < len(r); {
+		// Skip whitespace between parameters
+		if r[i] == ' ' || r[i] == '\t' || r[i] == '\n' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(r) && r[i] != '=' && r[i] != ' ' {
+			i++
+		}
+		key := string(r[start:i])
+		for i < len(r) && r[i] == ' ' {
+			i++
+		}
+		if i >= len(r) || r[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q in connection string", key)
+		}
+		i++
+		for i < len(r) && r[i] == ' ' {
+			i++
+		}
+
+		var value []rune
+		quoted := i < len(r) && r[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; i < len(r); i++ {
+			if r[i] == '\\' && i+1 < len(r) {
+				i++
+				value = append(value, r[i])
+				continue
+			}
+			if quoted && r[i] == '\'' {
+				break
+			}
+			if !quoted && (r[i] == ' ' || r[i] == '\t' || r[i] == '\n') {
+				break
+			}
+			value = append(value, r[i])
+		}
+		if quoted {
+			if i >= len(r) {
+				return nil, fmt.Errorf("unterminated quoted value for %q in connection string", key)
+			}
+			i++
+		}
+
+		params[key] = string(value)
+	}
+
+	return params, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"sort"
+)
+
+const (
+	dumpMapsText = "text"
+	dumpMapsJSON = "json"
+)
+
+var dumpMapsFormat = flag.String(
+	"dumpmaps-format", dumpMapsText,
+	"Format of --dumpmaps: text, or json for tooling.",
+)
+
+// dumpedNamespace is the JSON representation of a builtin namespace.
+type dumpedNamespace struct {
+	Namespace string         `json:"namespace"`
+	Queries   []dumpedQuery  `json:"queries,omitempty"`
+	Columns   []dumpedColumn `json:"columns"`
+}
+
+// dumpedQuery is the JSON representation of a query override.
+type dumpedQuery struct {
+	PgVersion string `json:"pg_version"`
+	Query     string `json:"query"`
+}
+
+// dumpedColumn is the JSON representation of a column mapping.
+type dumpedColumn struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+	PgVersion   string `json:"pg_version,omitempty"`
+}
+
+// writeMapsJSON writes the builtin metric maps and their query overrides to w
+// as JSON, sorted by namespace and column so dumps can be diffed.
+func writeMapsJSON(w io.Writer) error {
+	namespaces := make([]dumpedNamespace, 0, len(builtinMetricMaps))
+	for name, cmap := range builtinMetricMaps {
+		namespace := dumpedNamespace{Namespace: name, Columns: make([]dumpedColumn, 0, len(cmap))}
+		for _, queryOverride := range queryOverrides[name] {
+			namespace.Queries = append(namespace.Queries, dumpedQuery{
+				PgVersion: queryOverride.versionRange.String(),
+				Query:     queryOverride.query,
+			})
+		}
+		for column, details := range cmap {
+			dumped := dumpedColumn{
+				Name:        column,
+				Usage:       details.usage.String(),
+				Description: details.description,
+			}
+			if details.supportedVersions != nil {
+				dumped.PgVersion = details.supportedVersions.String()
+			}
+			namespace.Columns = append(namespace.Columns, dumped)
+		}
+		sort.Slice(namespace.Columns, func(i, j int) bool {
+			return namespace.Columns[i].Name < namespace.Columns[j].Name
+		})
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(namespaces)
+}
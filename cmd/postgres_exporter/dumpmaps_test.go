@@ -0,0 +1,53 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+type DumpMapsSuite struct{}
+
+var _ = Suite(&DumpMapsSuite{})
+
+func (s *DumpMapsSuite) TestWriteMapsJSON(c *C) {
+	var buf bytes.Buffer
+	c.Assert(writeMapsJSON(&buf), IsNil)
+	c.Check(bytes.Contains(buf.Bytes(), []byte(`"pg_version": "<17.0.0"`)), Equals, true)
+
+	var namespaces []dumpedNamespace
+	c.Assert(json.Unmarshal(buf.Bytes(), &namespaces), IsNil)
+	c.Assert(namespaces, HasLen, len(builtinMetricMaps))
+
+	var database *dumpedNamespace
+	for i := range namespaces {
+		if i > 0 {
+			c.Check(namespaces[i-1].Namespace < namespaces[i].Namespace, Equals, true)
+		}
+		if namespaces[i].Namespace == "pg_stat_database" {
+			database = &namespaces[i]
+		}
+	}
+	c.Assert(database, NotNil)
+	c.Check(database.Queries, HasLen, 0)
+
+	columns := make(map[string]dumpedColumn)
+	for _, column := range database.Columns {
+		columns[column.Name] = column
+	}
+	c.Check(columns["datname"], DeepEquals, dumpedColumn{Name: "datname", Usage: "LABEL", Description: "Name of this database"})
+	c.Check(columns["stats_reset"].Usage, Equals, "RESET_TIMESTAMP")
+	c.Check(columns["sessions"].PgVersion, Equals, ">=14.0.0")
+}
+
+func (s *DumpMapsSuite) TestColumnUsageString(c *C) {
+	for _, name := range []string{"DISCARD", "LABEL", "COUNTER", "GAUGE", "MAPPEDMETRIC", "DURATION", "SUMMARY", "HISTOGRAM", "COUNTER_RESETTABLE", "RESET_TIMESTAMP"} {
+		usage, err := stringToColumnUsage(name)
+		c.Assert(err, IsNil)
+		c.Check(usage.String(), Equals, name)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var metricHelpSuffix = flag.String(
+	"metric-help-suffix", "",
+	"Text appended to the help of every metric, e.g. \" [prod-cluster-a]\", to tell apart the metrics of several exporters.",
+)
+
+// helpSuffixGatherer appends a suffix to the help of the metrics of a
+// gatherer.
+type helpSuffixGatherer struct {
+	gatherer prometheus.Gatherer
+	suffix   string
+}
+
+// Gather implements prometheus.Gatherer.
+func (g helpSuffixGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.gatherer.Gather()
+	if g.suffix == "" {
+		return mfs, err
+	}
+	for _, mf := range mfs {
+		help := mf.GetHelp() + g.suffix
+		mf.Help = &help
+	}
+	return mfs, err
+}
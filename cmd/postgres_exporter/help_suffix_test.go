@@ -0,0 +1,27 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type HelpSuffixSuite struct{}
+
+var _ = Suite(&HelpSuffixSuite{})
+
+func (s *HelpSuffixSuite) TestGather(c *C) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "pg_up", Help: "Whether the last scrape was able to connect to the server."}))
+
+	mfs, err := helpSuffixGatherer{gatherer: registry, suffix: " [prod-cluster-a]"}.Gather()
+	c.Assert(err, IsNil)
+	c.Assert(mfs, HasLen, 1)
+	c.Check(mfs[0].GetHelp(), Equals, "Whether the last scrape was able to connect to the server. [prod-cluster-a]")
+
+	mfs, err = helpSuffixGatherer{gatherer: registry}.Gather()
+	c.Assert(err, IsNil)
+	c.Check(mfs[0].GetHelp(), Equals, "Whether the last scrape was able to connect to the server.")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lengths PostgreSQL converts months and years to seconds with, as in
+// EXTRACT(EPOCH FROM interval).
+const (
+	intervalDay   = 24 * time.Hour
+	intervalMonth = 30 * intervalDay
+	intervalYear  = 365*intervalDay + 6*time.Hour
+)
+
+// intervalUnits are the units of the postgres and postgres_verbose interval
+// styles.
+var intervalUnits = map[string]time.Duration{
+	"year": intervalYear, "years": intervalYear,
+	"mon": intervalMonth, "mons": intervalMonth,
+	"day": intervalDay, "days": intervalDay,
+	"hour": time.Hour, "hours": time.Hour,
+	"min": time.Minute, "mins": time.Minute,
+	"sec": time.Second, "secs": time.Second,
+}
+
+// sqlStandardYearMonthRegex matches the year-month field of the sql_standard
+// interval style, e.g. 1-2.
+var sqlStandardYearMonthRegex = regexp.MustCompile(`^([+-]?)(\d+)-(\d+)$`)
+
+// iso8601IntervalRegex matches the fields of the iso_8601 interval style,
+// e.g. P1Y2M3DT4H5M6.5S.
+var iso8601IntervalRegex = regexp.MustCompile(`([+-]?\d+(?:\.\d+)?)([YMWDHS])`)
+
+// parseInterval parses the text output of a PostgreSQL interval, in any of
+// the postgres (the default, e.g. "3 days 04:00:00"), postgres_verbose
+// ("@ 3 days 4 hours"), sql_standard ("3 4:00:00") and iso_8601
+// ("P3DT4H") interval styles.
+func parseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "P") {
+		return parseISO8601Interval(s)
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	ago := len(fields) > 0 && fields[len(fields)-1] == "ago"
+	if ago {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+
+	// A leading sign applies to every field unless another field has its
+	// own, e.g. "-1 2:03:04" in the sql_standard style. The postgres style
+	// always signs the fields after a negative one, e.g. "-1 days +02:03:04".
+	negateAll := strings.HasPrefix(fields[0], "-")
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, "-") || strings.HasPrefix(f, "+") {
+			negateAll = false
+		}
+	}
+	if negateAll {
+		fields[0] = fields[0][1:]
+	}
+
+	var total time.Duration
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if strings.Contains(field, ":") {
+			d, err := parseIntervalClock(field)
+			if err != nil {
+				return 0, fmt.Errorf("invalid interval %q: %s", s, err)
+			}
+			total += d
+			continue
+		}
+		if m := sqlStandardYearMonthRegex.FindStringSubmatch(field); m != nil {
+			years, _ := strconv.Atoi(m[2])
+			months, _ := strconv.Atoi(m[3])
+			d := time.Duration(years)*intervalYear + time.Duration(months)*intervalMonth
+			if m[1] == "-" {
+				d = -d
+			}
+			total += d
+			continue
+		}
+
+		n, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		unit := intervalDay // Bare day count of the sql_standard style
+		if i+1 < len(fields) {
+			if u, ok := intervalUnits[fields[i+1]]; ok {
+				unit = u
+				i++
+			}
+		}
+		total += time.Duration(n * float64(unit))
+	}
+
+	if negateAll != ago {
+		total = -total
+	}
+	return total, nil
+}
+
+// parseIntervalClock parses the [-+]hh:mm[:ss[.ffffff]] time field of an
+// interval.
+func parseIntervalClock(field string) (time.Duration, error) {
+	negative := strings.HasPrefix(field, "-")
+	parts := strings.Split(strings.TrimLeft(field, "+-"), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", field)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second}[:len(parts)] {
+		n, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", field)
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseISO8601Interval parses an interval in the iso_8601 style, whose
+// minutes are told apart from months by following the T.
+func parseISO8601Interval(s string) (time.Duration, error) {
+	date, clock := strings.TrimPrefix(s, "P"), ""
+	if i := strings.Index(date, "T"); i >= 0 {
+		date, clock = date[:i], date[i+1:]
+	}
+
+	var total time.Duration
+	for _, part := range []struct {
+		text  string
+		units map[string]time.Duration
+	}{
+		{date, map[string]time.Duration{"Y": intervalYear, "M": intervalMonth, "W": 7 * intervalDay, "D": intervalDay}},
+		{clock, map[string]time.Duration{"H": time.Hour, "M": time.Minute, "S": time.Second}},
+	} {
+		rest := part.text
+		for _, m := range iso8601IntervalRegex.FindAllStringSubmatch(part.text, -1) {
+			unit, ok := part.units[m[2]]
+			if !ok {
+				return 0, fmt.Errorf("invalid interval %q", s)
+			}
+			n, _ := strconv.ParseFloat(m[1], 64)
+			total += time.Duration(n * float64(unit))
+			rest = strings.Replace(rest, m[0], "", 1)
+		}
+		if rest != "" {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+	}
+	if s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	return total, nil
+}
@@ -0,0 +1,93 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type IntervalSuite struct{}
+
+var _ = Suite(&IntervalSuite{})
+
+func (s *IntervalSuite) TestParseInterval(c *C) {
+	day := 24 * time.Hour
+	for _, t := range []struct {
+		in   string
+		want time.Duration
+	}{
+		// postgres
+		{"01:23:45", time.Hour + 23*time.Minute + 45*time.Second},
+		{"00:00:00.5", 500 * time.Millisecond},
+		{"3 days 04:00:00", 3*day + 4*time.Hour},
+		{"1 year 2 mons", 365*day + 6*time.Hour + 60*day},
+		{"-1 days +02:03:00", -day + 2*time.Hour + 3*time.Minute},
+		{"-00:00:01", -time.Second},
+		// postgres_verbose
+		{"@ 3 days 4 hours 5 mins 6.5 secs", 3*day + 4*time.Hour + 5*time.Minute + 6500*time.Millisecond},
+		{"@ 1 day ago", -day},
+		// sql_standard
+		{"3 4:00:00", 3*day + 4*time.Hour},
+		{"-1 2:03:04", -(day + 2*time.Hour + 3*time.Minute + 4*time.Second)},
+		{"1-2", 365*day + 6*time.Hour + 60*day},
+		// iso_8601
+		{"P3DT4H", 3*day + 4*time.Hour},
+		{"PT1M30.5S", time.Minute + 30500*time.Millisecond},
+		{"P1Y2M", 365*day + 6*time.Hour + 60*day},
+		{"P-1DT2H", -day + 2*time.Hour},
+	} {
+		d, err := parseInterval(t.in)
+		c.Check(err, IsNil, Commentf("interval %q", t.in))
+		c.Check(d, Equals, t.want, Commentf("interval %q", t.in))
+	}
+
+	for _, in := range []string{"", "soon", "3 fortnights", "1:2:3:4", "P", "PT", "P3X", "P1H"} {
+		_, err := parseInterval(in)
+		c.Check(err, ErrorMatches, "invalid .*", Commentf("interval %q", in))
+	}
+}
+
+func (s *IntervalSuite) TestDurationConversion(c *C) {
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_test": {"wait": {DURATION, "Wait", nil, nil}},
+	}
+	conversion := makeDescMap(semver.MustParse("10.0.0"), metricMaps, descMapOptions{})["pg_test"].columnMappings["wait"].conversion
+
+	for _, t := range []struct {
+		in   interface{}
+		want float64
+	}{
+		{"1.5s", 1500},
+		{"01:23:45", 5025000},
+		{"3 days 04:00:00", 273600000},
+		{[]byte("@ 1 min"), 60000},
+	} {
+		v, ok := conversion(t.in)
+		c.Check(ok, Equals, true, Commentf("value %v", t.in))
+		c.Check(v, Equals, t.want, Commentf("value %v", t.in))
+	}
+
+	v, ok := conversion("-1")
+	c.Check(ok, Equals, true)
+	c.Check(math.IsNaN(v), Equals, true)
+
+	_, ok = conversion("soon")
+	c.Check(ok, Equals, false)
+
+	v, ok = conversion(nil)
+	c.Check(ok, Equals, true)
+	c.Check(math.IsNaN(v), Equals, true)
+
+	v, ok = conversion(int64(250))
+	c.Check(ok, Equals, true)
+	c.Check(v, Equals, 250.0)
+
+	v, ok = conversion(1.5)
+	c.Check(ok, Equals, true)
+	c.Check(v, Equals, 1.5)
+}
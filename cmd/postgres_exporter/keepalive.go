@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	keepalives = flag.Bool(
+		"db.keepalives", true,
+		"Use TCP keepalives on the database connection. Merged into the DSN as keepalives.",
+	)
+	keepalivesIdle = flag.Duration(
+		"db.keepalives-idle", 0,
+		"Idle time before the first TCP keepalive is sent, 0 uses the system default. Merged into the DSN as keepalives_idle.",
+	)
+	keepalivesInterval = flag.Duration(
+		"db.keepalives-interval", 0,
+		"Interval between unanswered TCP keepalives, 0 uses the system default. Merged into the DSN as keepalives_interval.",
+	)
+	keepalivesCount = flag.Int64(
+		"db.keepalives-count", 0,
+		"Number of unanswered TCP keepalives before the connection is considered dead, 0 uses the system default. Merged into the DSN as keepalives_count.",
+	)
+)
+
+// keepaliveParams are the libpq keepalive connection parameters, which pgx
+// does not support itself.
+var keepaliveParams = []string{"keepalives", "keepalives_idle", "keepalives_interval", "keepalives_count"}
+
+// addKeepaliveParams merges the keepalive flags into dsn.
+func addKeepaliveParams(dsn string) (string, error) {
+	var err error
+	if !lookupConfig("db.keepalives", *keepalives).(bool) {
+		if dsn, err = setDSNParam(dsn, "keepalives", "0"); err != nil {
+			return "", err
+		}
+	}
+	if idle := lookupConfig("db.keepalives-idle", *keepalivesIdle).(time.Duration); idle > 0 {
+		if dsn, err = setDSNParam(dsn, "keepalives_idle", strconv.Itoa(int(idle.Seconds()))); err != nil {
+			return "", err
+		}
+	}
+	if interval := lookupConfig("db.keepalives-interval", *keepalivesInterval).(time.Duration); interval > 0 {
+		if dsn, err = setDSNParam(dsn, "keepalives_interval", strconv.Itoa(int(interval.Seconds()))); err != nil {
+			return "", err
+		}
+	}
+	if count := lookupConfig("db.keepalives-count", *keepalivesCount).(int64); count > 0 {
+		if dsn, err = setDSNParam(dsn, "keepalives_count", strconv.FormatInt(count, 10)); err != nil {
+			return "", err
+		}
+	}
+	return dsn, nil
+}
+
+// splitKeepaliveParams removes the keepalive parameters from dsn and returns
+// them separately. dsn is returned unchanged if it has none.
+func splitKeepaliveParams(dsn string) (string, map[string]string, error) {
+	found := make(map[string]string)
+
+	if isURLDSN(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", nil, err
+		}
+		q := u.Query()
+		for _, key := range keepaliveParams {
+			if _, ok := q[key]; ok {
+				found[key] = q.Get(key)
+				q.Del(key)
+			}
+		}
+		if len(found) == 0 {
+			return dsn, found, nil
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), found, nil
+	}
+
+	params, err := parseKeyValueDSN(dsn)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, key := range keepaliveParams {
+		if value, ok := params[key]; ok {
+			found[key] = value
+			delete(params, key)
+		}
+	}
+	if len(found) == 0 {
+		return dsn, found, nil
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+quoteDSNValue(params[key]))
+	}
+	return strings.Join(pairs, " "), found, nil
+}
+
+// keepaliveDialer dials the database connections, setting up TCP keepalives
+// as configured by the libpq keepalive parameters. The connect timeout is
+// applied by pgx through the context.
+type keepaliveDialer struct {
+	net.Dialer
+}
+
+func newKeepaliveDialer(params map[string]string) (keepaliveDialer, error) {
+	var d keepaliveDialer
+	// Unset and 0 values leave the system default, as with libpq; net
+	// replaces 0 with its own defaults, and leaves negative values alone.
+	value := func(key string) (int, error) {
+		v, ok := params[key]
+		if !ok || v == "" {
+			return -1, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %s", key, v, err)
+		}
+		if n == 0 {
+			return -1, nil
+		}
+		return n, nil
+	}
+
+	if params["keepalives"] == "0" {
+		d.KeepAlive = -1
+		return d, nil
+	}
+
+	// net.KeepAliveConfig, setting the idle time, interval and count on
+	// every platform, is what makes go.mod require Go 1.23.
+	d.KeepAliveConfig.Enable = true
+	idle, err := value("keepalives_idle")
+	if err != nil {
+		return d, err
+	}
+	interval, err := value("keepalives_interval")
+	if err != nil {
+		return d, err
+	}
+	if d.KeepAliveConfig.Count, err = value("keepalives_count"); err != nil {
+		return d, err
+	}
+	d.KeepAliveConfig.Idle = time.Duration(idle) * time.Second
+	d.KeepAliveConfig.Interval = time.Duration(interval) * time.Second
+	return d, nil
+}
@@ -0,0 +1,57 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type KeepaliveSuite struct{}
+
+var _ = Suite(&KeepaliveSuite{})
+
+func (s *KeepaliveSuite) TestSplitKeepaliveParams(c *C) {
+	dsn, params, err := splitKeepaliveParams("host=localhost keepalives_idle=30 user=postgres")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "host='localhost' user='postgres'")
+	c.Check(params, DeepEquals, map[string]string{"keepalives_idle": "30"})
+
+	dsn, params, err = splitKeepaliveParams("postgresql://localhost/postgres?keepalives=0&sslmode=disable")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "postgresql://localhost/postgres?sslmode=disable")
+	c.Check(params, DeepEquals, map[string]string{"keepalives": "0"})
+
+	// DSNs without keepalive parameters are left alone
+	dsn, params, err = splitKeepaliveParams("host=localhost  user=postgres")
+	c.Assert(err, IsNil)
+	c.Check(dsn, Equals, "host=localhost  user=postgres")
+	c.Check(params, HasLen, 0)
+}
+
+func (s *KeepaliveSuite) TestNewKeepaliveDialer(c *C) {
+	d, err := newKeepaliveDialer(map[string]string{"keepalives_idle": "30", "keepalives_interval": "10", "keepalives_count": "3"})
+	c.Assert(err, IsNil)
+	c.Check(d.KeepAliveConfig.Enable, Equals, true)
+	c.Check(d.KeepAliveConfig.Idle, Equals, 30*time.Second)
+	c.Check(d.KeepAliveConfig.Interval, Equals, 10*time.Second)
+	c.Check(d.KeepAliveConfig.Count, Equals, 3)
+
+	// Unset and 0 values keep the system default rather than net's own
+	d, err = newKeepaliveDialer(map[string]string{"keepalives_idle": "0"})
+	c.Assert(err, IsNil)
+	c.Check(d.KeepAliveConfig.Enable, Equals, true)
+	c.Check(d.KeepAliveConfig.Idle < 0, Equals, true)
+	c.Check(d.KeepAliveConfig.Interval < 0, Equals, true)
+	c.Check(d.KeepAliveConfig.Count < 0, Equals, true)
+
+	d, err = newKeepaliveDialer(map[string]string{"keepalives": "0", "keepalives_idle": "30"})
+	c.Assert(err, IsNil)
+	c.Check(d.KeepAlive, Equals, time.Duration(-1))
+	c.Check(d.KeepAliveConfig.Enable, Equals, false)
+
+	_, err = newKeepaliveDialer(map[string]string{"keepalives_idle": "soon"})
+	c.Check(err, ErrorMatches, `invalid keepalives_idle "soon".*`)
+}
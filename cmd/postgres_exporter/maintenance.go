@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	maintenanceFile = flag.String(
+		"maintenance-file", "",
+		"Path of a file whose presence puts the exporter in maintenance mode, reported by pg_exporter_maintenance_mode. Also settable with PG_EXPORTER_MAINTENANCE_FILE.",
+	)
+	maintenanceSuppressErrors = flag.Bool(
+		"maintenance-suppress-errors", false,
+		"Keep pg_up and pg_exporter_last_scrape_error at their values from before maintenance mode while it lasts.",
+	)
+)
+
+// inMaintenance returns whether the maintenance file exists.
+func (e *Exporter) inMaintenance() bool {
+	if e.maintenanceFile == "" {
+		return false
+	}
+	_, err := os.Stat(e.maintenanceFile)
+	return err == nil
+}
+
+// gaugeValue returns the current value of g.
+func gaugeValue(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,88 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type MaintenanceSuite struct{}
+
+var _ = Suite(&MaintenanceSuite{})
+
+// collect runs a scrape of e, discarding its metrics.
+func collect(e *Exporter) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	e.Collect(ch)
+	close(ch)
+	<-done
+}
+
+func (s *MaintenanceSuite) TestMaintenanceSuppressErrors(c *C) {
+	path := filepath.Join(c.MkDir(), "maintenance")
+	// Nothing listens on port 1, so scrapes fail to connect
+	e := NewExporter("host=127.0.0.1 port=1 sslmode=disable", DisableDefaultMetrics(true), WithMaintenanceFile(path, true))
+	e.psqlUp.Set(1)
+
+	c.Assert(ioutil.WriteFile(path, nil, 0600), IsNil)
+	collect(e)
+	c.Check(gaugeValue(e.maintenanceMode), Equals, float64(1))
+	c.Check(gaugeValue(e.psqlUp), Equals, float64(1))
+	c.Check(gaugeValue(e.error), Equals, float64(0))
+
+	c.Assert(os.Remove(path), IsNil)
+	collect(e)
+	c.Check(gaugeValue(e.maintenanceMode), Equals, float64(0))
+	c.Check(gaugeValue(e.psqlUp), Equals, float64(0))
+	c.Check(gaugeValue(e.error), Equals, float64(1))
+}
+
+func (s *MaintenanceSuite) TestMaintenanceSuppressErrorsConcurrently(c *C) {
+	path := filepath.Join(c.MkDir(), "maintenance")
+	e := NewExporter("host=127.0.0.1 port=1 sslmode=disable", DisableDefaultMetrics(true), WithMaintenanceFile(path, true))
+	e.psqlUp.Set(1)
+
+	c.Assert(ioutil.WriteFile(path, nil, 0600), IsNil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collect(e)
+		}()
+	}
+	wg.Wait()
+	c.Check(gaugeValue(e.psqlUp), Equals, float64(1))
+	c.Check(gaugeValue(e.error), Equals, float64(0))
+}
+
+func (s *MaintenanceSuite) TestMaintenanceFileEnvironment(c *C) {
+	c.Assert(os.Setenv("PG_EXPORTER_MAINTENANCE_FILE", "/run/maintenance"), IsNil)
+	defer UnsetEnvironment(c, "PG_EXPORTER_MAINTENANCE_FILE")
+
+	c.Check(lookupEnvConfig("maintenance-file", "PG_EXPORTER_MAINTENANCE_FILE", *maintenanceFile), Equals, "/run/maintenance")
+}
+
+func (s *MaintenanceSuite) TestMaintenanceReportsErrors(c *C) {
+	path := filepath.Join(c.MkDir(), "maintenance")
+	e := NewExporter("host=127.0.0.1 port=1 sslmode=disable", DisableDefaultMetrics(true), WithMaintenanceFile(path, false))
+	e.psqlUp.Set(1)
+
+	c.Assert(ioutil.WriteFile(path, nil, 0600), IsNil)
+	collect(e)
+	c.Check(gaugeValue(e.maintenanceMode), Equals, float64(1))
+	c.Check(gaugeValue(e.psqlUp), Equals, float64(0))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrapeOnce scrapes the exporter into a fresh registry, relabeled with
+// rules and with helpSuffix appended to the help of the metrics, and writes
+// the metrics to w in the text format, or pushes them to the Pushgateway at
+// pushGatewayURL if it is set.
+func scrapeOnce(exporter *Exporter, rules []relabelRule, helpSuffix string, w io.Writer, pushGatewayURL, job string) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(exporter); err != nil {
+		return err
+	}
+	gatherer := helpSuffixGatherer{gatherer: relabelGatherer{gatherer: registry, rules: rules}, suffix: helpSuffix}
+
+	if pushGatewayURL != "" {
+		return push.FromGatherer(job, push.HostnameGroupingKey(), pushGatewayURL, gatherer)
+	}
+
+	metricFamilies, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range metricFamilies {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"flag"
+)
+
+var perBackendLimit = flag.Int64(
+	"per-backend.limit", 100,
+	"Maximum number of backends the per-backend collector reports, those with the oldest transactions first.",
+)
@@ -36,11 +36,30 @@ func querySettings(ch chan<- prometheus.Metric, db *sql.DB) error {
 		}
 
 		ch <- s.metric()
+		if memorySettings[s.name] {
+			ch <- s.memoryMetric()
+		}
 	}
 
 	return nil
 }
 
+// memorySettings are the runtime variables which are additionally exported
+// as pg_config_memory_bytes, so their sizes can be compared across servers
+// regardless of the unit they were configured in.
+var memorySettings = map[string]bool{
+	"shared_buffers":       true,
+	"work_mem":             true,
+	"maintenance_work_mem": true,
+	"effective_cache_size": true,
+}
+
+var configMemoryDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "config", "memory_bytes"),
+	"Memory related runtime variables, converted to bytes.",
+	[]string{"setting"}, nil,
+)
+
 // pgSetting is represents a PostgreSQL runtime variable as returned by the
 // pg_settings view.
 type pgSetting struct {
@@ -82,6 +101,20 @@ func (s *pgSetting) metric() prometheus.Metric {
 	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, val)
 }
 
+// memoryMetric returns the setting as a pg_config_memory_bytes sample.
+func (s *pgSetting) memoryMetric() prometheus.Metric {
+	val, unit, err := s.normaliseUnit()
+	if err != nil {
+		// Panic, for the same reasons as in metric()
+		panic(err)
+	}
+	if unit != "bytes" {
+		panic(fmt.Sprintf("Runtime variable %q is not a memory size: unit %q", s.name, s.unit))
+	}
+
+	return prometheus.MustNewConstMetric(configMemoryDesc, prometheus.GaugeValue, val, s.name)
+}
+
 // TODO: fix linter override
 // nolint: nakedret
 func (s *pgSetting) normaliseUnit() (val float64, unit string, err error) {
@@ -241,6 +241,29 @@ func (s *PgSettingSuite) TestMetric(c *C) {
 	}
 }
 
+func (s *PgSettingSuite) TestMemoryMetric(c *C) {
+	for _, p := range []pgSetting{
+		{name: "shared_buffers", setting: "16384", unit: "8kB", vartype: "integer"},
+		{name: "work_mem", setting: "4096", unit: "kB", vartype: "integer"},
+		{name: "maintenance_work_mem", setting: "128", unit: "MB", vartype: "integer"},
+	} {
+		d := &dto.Metric{}
+		m := p.memoryMetric()
+		m.Write(d) // nolint: errcheck
+
+		c.Check(m.Desc().String(), Equals, "Desc{fqName: \"pg_config_memory_bytes\", help: \"Memory related runtime variables, converted to bytes.\", constLabels: {}, variableLabels: [setting]}")
+		c.Check(d.GetLabel()[0].GetValue(), Equals, p.name)
+	}
+
+	d := &dto.Metric{}
+	(&pgSetting{name: "work_mem", setting: "4096", unit: "kB", vartype: "integer"}).memoryMetric().Write(d) // nolint: errcheck
+	c.Check(d.GetGauge().GetValue(), Equals, float64(4194304))
+
+	c.Check(func() {
+		(&pgSetting{name: "max_connections", setting: "100", unit: "", vartype: "integer"}).memoryMetric()
+	}, PanicMatches, `Runtime variable "max_connections" is not a memory size.*`)
+}
+
 type normalised struct {
 	val  float64
 	unit string
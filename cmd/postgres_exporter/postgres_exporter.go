@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
@@ -8,16 +9,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/blang/semver"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gopkg.in/ini.v1"
 	"gopkg.in/yaml.v2"
 
@@ -27,8 +32,6 @@ import (
 	"github.com/prometheus/common/version"
 
 	"strings"
-
-	"github.com/shatteredsilicon/exporter_shared"
 )
 
 var (
@@ -56,10 +59,90 @@ var (
 		"extend.query-path", getStringEnv("PG_EXPORTER_EXTEND_QUERY_PATH", ""),
 		"Path to custom queries to run.",
 	)
+	userQueriesPriority = flag.String(
+		"user-queries-priority", userQueriesReplace,
+		"How custom queries for a namespace which is already defined are merged: replace the builtin namespace, prepend their columns to it, or append it alongside as <namespace>_user.",
+	)
 	onlyDumpMaps = flag.Bool(
 		"dumpmaps", false,
 		"Do not run, simply dump the maps.",
 	)
+	dumpQuery = flag.String(
+		"dump-query", "",
+		"Do not run, print the query run for this namespace on the --assume-pg-version PostgreSQL version.",
+	)
+	assumePgVersion = flag.String(
+		"assume-pg-version", "",
+		"PostgreSQL version to resolve the query of --dump-query for, e.g. 13.4.",
+	)
+	queryTimeout = flag.Duration(
+		"query-timeout", 0,
+		"Cancel the query of a namespace running longer than this, so a slow one does not block the whole scrape. 0 never cancels.",
+	)
+	exitOnDBUnreachable = flag.Duration(
+		"exit-on-db-unreachable", 0,
+		"Exit with a non-zero code when a scrape cannot connect to the database and none could for this long, so an orchestrator restarts the exporter. 0 never exits.",
+	)
+	debugMetrics = flag.Bool(
+		"debug-metrics", false,
+		"Also report metrics for debugging queries, such as the number of rows each namespace query returned.",
+	)
+	once = flag.Bool(
+		"once", false,
+		"Scrape once, print the metrics to stdout (or push them to push-gateway) and exit.",
+	)
+	pushGateway = flag.String(
+		"push-gateway", "",
+		"URL of a Pushgateway to push the metrics to in --once mode, instead of printing them.",
+	)
+	pushJob = flag.String(
+		"push-job", "postgres_exporter",
+		"Job name to push the metrics under in --once mode.",
+	)
+	searchPath = flag.String(
+		"db.search-path", "",
+		"Schema search_path to set before running namespace queries. Also settable with PG_EXPORTER_DB_SEARCH_PATH.",
+	)
+	nullLabelValue = flag.String(
+		"null-label-value", "",
+		"Label value to use for NULL label columns, e.g. \"unknown\". Also settable with PG_EXPORTER_NULL_LABEL_VALUE.",
+	)
+	dbOptions = flag.String(
+		"db.options", "",
+		"Command-line options to send to the server at connection start, e.g. \"-c application_name=postgres_exporter\". Merged into the options of the DSN. Also settable with PG_EXPORTER_DB_OPTIONS.",
+	)
+	dataSourceFile = flag.String(
+		"data-source-file", "",
+		"Path of a file holding the DSN to connect with, used when DATA_SOURCE_NAME is not set. Blank lines and lines starting with # are skipped. Also settable with DATA_SOURCE_FILE.",
+	)
+	replicaDSN = flag.String(
+		"replica-dsn", "",
+		"DSN of a read-only replica to run the custom queries marked prefer_replica, and the --replica-namespaces, against, to spare the primary. Also settable with PG_EXPORTER_REPLICA_DSN.",
+	)
+	setRole = flag.String(
+		"db.set-role", "",
+		"Role to switch to with SET ROLE on each new database connection, so queries run with its privileges. Also settable with PG_EXPORTER_DB_SET_ROLE.",
+	)
+	connectTimeout = flag.Duration(
+		"db.connect-timeout", 0,
+		"Give up connecting to the database after this long, so an unreachable server fails the scrape fast. Merged into the DSN as connect_timeout. 0 waits indefinitely.",
+	)
+	maxConnectionAge = flag.Duration(
+		"db.max-connection-age", 0,
+		"Close and reopen the database connection once it is this old, so a DNS name failing over to another server is resolved again. 0 keeps it open until it fails.",
+	)
+	maxOpenConns = flag.Int64(
+		"db.max-open-conns", 1,
+		"Maximum number of open connections to the database, and to the replica.",
+	)
+	maxIdleConns = flag.Int64(
+		"db.max-idle-conns", 1,
+		"Maximum number of idle connections kept open to the database, and to the replica.",
+	)
+	lockTimeoutMS = flag.Int64(
+		"db.lock-timeout-ms", 0,
+		"Milliseconds metric queries wait for a lock, e.g. behind DDL, before failing. Sent to the server as lock_timeout in the options of the DSN. 0 waits indefinitely.",
+	)
 )
 
 // Metric name parts.
@@ -89,6 +172,11 @@ const (
 	GAUGE        ColumnUsage = iota // Use this column as a gauge
 	MAPPEDMETRIC ColumnUsage = iota // Use this column with the supplied mapping of text values
 	DURATION     ColumnUsage = iota // This column should be interpreted as a text duration (and converted to milliseconds)
+	SUMMARY      ColumnUsage = iota // Emit a summary from the quantile, sum and count columns named by this pseudo-column
+	HISTOGRAM    ColumnUsage = iota // Emit a histogram from the bucket, sum and count columns named by this pseudo-column
+
+	COUNTERRESETTABLE ColumnUsage = iota // Use this column as a counter, and count the times it decreased between scrapes
+	RESETTIMESTAMP    ColumnUsage = iota // Use this timestamp column as a gauge, and count the times it changed between scrapes
 )
 
 // UnmarshalYAML implements the yaml.Unmarshaller interface.
@@ -127,7 +215,7 @@ type ColumnMapping struct {
 	usage             ColumnUsage        `yaml:"usage"`
 	description       string             `yaml:"description"`
 	mapping           map[string]float64 `yaml:"metric_mapping"` // Optional column mapping for MAPPEDMETRIC
-	supportedVersions semver.Range       `yaml:"pg_version"`     // Semantic version ranges which are supported. Unsupported columns are not queried (internally converted to DISCARD).
+	supportedVersions *versionRange      `yaml:"pg_version"`     // Semantic version ranges which are supported. Unsupported columns are not queried (internally converted to DISCARD).
 }
 
 // UnmarshalYAML implements yaml.Unmarshaller
@@ -138,8 +226,25 @@ func (cm *ColumnMapping) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 // MetricMapNamespace groups metric maps under a shared set of labels.
 type MetricMapNamespace struct {
-	labels         []string             // Label names for this namespace
-	columnMappings map[string]MetricMap // Column mappings in this namespace
+	labels          []string                  // Label names for this namespace
+	prefix          string                    // Metric name prefix of this namespace, the namespace unless renamed
+	columnMappings  map[string]MetricMap      // Column mappings in this namespace
+	searchPath      string                    // Optional search_path to run the namespace query with
+	forEachSchema   string                    // Optional pattern of schemas to run the namespace query in
+	summaries       map[string]summaryColumns // Columns of the SUMMARY and HISTOGRAM pseudo-columns of this namespace
+	emitZeroOnEmpty bool                      // Emit 0 for every metric if the query returns no rows
+	preferReplica   bool                      // Run the query on the replica if one is available
+	userQuery       bool                      // Whether the query comes from the user queries file
+	tags            []string                  // Tags of the user query, to serve it under the telemetry path of each
+}
+
+// summaryColumns names the columns a summary, or a histogram, is built from.
+type summaryColumns struct {
+	quantiles map[float64]string // Column holding the value of each quantile
+	histogram bool               // Whether to build a histogram rather than a summary
+	buckets   map[float64]string // Column holding the cumulative count of each bucket upper bound
+	sum       string
+	count     string
 }
 
 // MetricMap stores the prometheus metric description which a given column will
@@ -149,6 +254,48 @@ type MetricMap struct {
 	vtype      prometheus.ValueType              // Prometheus valuetype
 	desc       *prometheus.Desc                  // Prometheus descriptor
 	conversion func(interface{}) (float64, bool) // Conversion function to turn PG result into float64
+	resets     *prometheus.Desc                  // Descriptor of the resets counter of COUNTER_RESETTABLE and RESET_TIMESTAMP columns
+	onChange   bool                              // Count changes of the value as resets, rather than decreases
+	average    string                            // Column whose change between scrapes divides that of this column
+}
+
+// namespaceQuery returns the query the exporter runs for namespace on
+// pgVersion, with the metric maps loaded for it the way the first scrape
+// loads them.
+func (e *Exporter) namespaceQuery(namespace string, pgVersion semver.Version) (string, error) {
+	if err := e.loadMaps(pgVersion); err != nil {
+		return "", err
+	}
+
+	mapping, found := e.metricMap[namespace]
+	if !found {
+		return "", fmt.Errorf("unknown namespace %q", namespace)
+	}
+	query, found := e.queryOverrides[namespace]
+	if found && query == "" {
+		return "", fmt.Errorf("namespace %q is not collected on PostgreSQL %s", namespace, pgVersion)
+	}
+	if !found {
+		query = defaultNamespaceQuery(namespace)
+	}
+
+	searchPath := e.searchPath
+	if mapping.searchPath != "" {
+		searchPath = mapping.searchPath
+	}
+	if mapping.forEachSchema != "" {
+		query = fmt.Sprintf("-- run with search_path set to each schema matching %q\n%s", mapping.forEachSchema, query)
+	} else if searchPath != "" {
+		query = fmt.Sprintf("-- run with search_path %s\n%s", searchPath, query)
+	}
+	return query, nil
+}
+
+// defaultNamespaceQuery returns the query for namespaces without an override.
+func defaultNamespaceQuery(namespace string) string {
+	// I've no idea how to avoid this properly at the moment, but this is
+	// an admin tool so you're not injecting SQL right?
+	return fmt.Sprintf("SELECT * FROM %s;", namespace)
 }
 
 // TODO: revisit this with the semver system
@@ -172,6 +319,8 @@ func dumpMaps() {
 }
 
 var builtinMetricMaps = map[string]map[string]ColumnMapping{
+	// PostgreSQL 17 moved the checkpoint columns to pg_stat_checkpointer and
+	// the backend ones to pg_stat_io, the query override brings them back.
 	"pg_stat_bgwriter": {
 		"checkpoints_timed":     {COUNTER, "Number of scheduled checkpoints that have been performed", nil, nil},
 		"checkpoints_req":       {COUNTER, "Number of requested checkpoints that have been performed", nil, nil},
@@ -183,28 +332,52 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 		"buffers_backend":       {COUNTER, "Number of buffers written directly by a backend", nil, nil},
 		"buffers_backend_fsync": {COUNTER, "Number of times a backend had to execute its own fsync call (normally the background writer handles those even when the backend does its own write)", nil, nil},
 		"buffers_alloc":         {COUNTER, "Number of buffers allocated", nil, nil},
-		"stats_reset":           {COUNTER, "Time at which these statistics were last reset", nil, nil},
+		"stats_reset":           {RESETTIMESTAMP, "Time at which these statistics were last reset", nil, nil},
 	},
+	// PostgreSQL 18 moved the write and sync columns to pg_stat_io.
+	"pg_stat_wal": {
+		"wal_records":      {COUNTER, "Total number of WAL records generated", nil, nil},
+		"wal_fpi":          {COUNTER, "Total number of WAL full page images generated", nil, nil},
+		"wal_bytes":        {COUNTER, "Total amount of WAL generated in bytes", nil, nil},
+		"wal_buffers_full": {COUNTER, "Number of times WAL data was written to disk because WAL buffers became full", nil, nil},
+		"wal_write":        {COUNTER, "Number of times WAL buffers were written out to disk", nil, mustParseVersionRange("<18.0.0")},
+		"wal_sync":         {COUNTER, "Number of times WAL files were synced to disk", nil, mustParseVersionRange("<18.0.0")},
+		"wal_write_time":   {COUNTER, "Total amount of time spent writing WAL buffers to disk, in milliseconds (requires track_wal_io_timing)", nil, mustParseVersionRange("<18.0.0")},
+		"wal_sync_time":    {COUNTER, "Total amount of time spent syncing WAL files to disk, in milliseconds (requires track_wal_io_timing)", nil, mustParseVersionRange("<18.0.0")},
+		"stats_reset":      {RESETTIMESTAMP, "Time at which these statistics were last reset", nil, nil},
+	},
+	// The counters are named after the columns of the view, without a _total
+	// suffix, so pg_stat_database_sessions matches xact_commit, deadlocks and
+	// the sessions_* counters.
 	"pg_stat_database": {
-		"datid":          {LABEL, "OID of a database", nil, nil},
-		"datname":        {LABEL, "Name of this database", nil, nil},
-		"numbackends":    {GAUGE, "Number of backends currently connected to this database. This is the only column in this view that returns a value reflecting current state; all other columns return the accumulated values since the last reset.", nil, nil},
-		"xact_commit":    {COUNTER, "Number of transactions in this database that have been committed", nil, nil},
-		"xact_rollback":  {COUNTER, "Number of transactions in this database that have been rolled back", nil, nil},
-		"blks_read":      {COUNTER, "Number of disk blocks read in this database", nil, nil},
-		"blks_hit":       {COUNTER, "Number of times disk blocks were found already in the buffer cache, so that a read was not necessary (this only includes hits in the PostgreSQL buffer cache, not the operating system's file system cache)", nil, nil},
-		"tup_returned":   {COUNTER, "Number of rows returned by queries in this database", nil, nil},
-		"tup_fetched":    {COUNTER, "Number of rows fetched by queries in this database", nil, nil},
-		"tup_inserted":   {COUNTER, "Number of rows inserted by queries in this database", nil, nil},
-		"tup_updated":    {COUNTER, "Number of rows updated by queries in this database", nil, nil},
-		"tup_deleted":    {COUNTER, "Number of rows deleted by queries in this database", nil, nil},
-		"conflicts":      {COUNTER, "Number of queries canceled due to conflicts with recovery in this database. (Conflicts occur only on standby servers; see pg_stat_database_conflicts for details.)", nil, nil},
-		"temp_files":     {COUNTER, "Number of temporary files created by queries in this database. All temporary files are counted, regardless of why the temporary file was created (e.g., sorting or hashing), and regardless of the log_temp_files setting.", nil, nil},
-		"temp_bytes":     {COUNTER, "Total amount of data written to temporary files by queries in this database. All temporary files are counted, regardless of why the temporary file was created, and regardless of the log_temp_files setting.", nil, nil},
-		"deadlocks":      {COUNTER, "Number of deadlocks detected in this database", nil, nil},
-		"blk_read_time":  {COUNTER, "Time spent reading data file blocks by backends in this database, in milliseconds", nil, nil},
-		"blk_write_time": {COUNTER, "Time spent writing data file blocks by backends in this database, in milliseconds", nil, nil},
-		"stats_reset":    {COUNTER, "Time at which these statistics were last reset", nil, nil},
+		"datid":                    {LABEL, "OID of a database", nil, nil},
+		"datname":                  {LABEL, "Name of this database", nil, nil},
+		"numbackends":              {GAUGE, "Number of backends currently connected to this database. This is the only column in this view that returns a value reflecting current state; all other columns return the accumulated values since the last reset.", nil, nil},
+		"xact_commit":              {COUNTER, "Number of transactions in this database that have been committed", nil, nil},
+		"xact_rollback":            {COUNTER, "Number of transactions in this database that have been rolled back", nil, nil},
+		"blks_read":                {COUNTER, "Number of disk blocks read in this database", nil, nil},
+		"blks_hit":                 {COUNTER, "Number of times disk blocks were found already in the buffer cache, so that a read was not necessary (this only includes hits in the PostgreSQL buffer cache, not the operating system's file system cache)", nil, nil},
+		"tup_returned":             {COUNTER, "Number of rows returned by queries in this database", nil, nil},
+		"tup_fetched":              {COUNTER, "Number of rows fetched by queries in this database", nil, nil},
+		"tup_inserted":             {COUNTER, "Number of rows inserted by queries in this database", nil, nil},
+		"tup_updated":              {COUNTER, "Number of rows updated by queries in this database", nil, nil},
+		"tup_deleted":              {COUNTER, "Number of rows deleted by queries in this database", nil, nil},
+		"conflicts":                {COUNTER, "Number of queries canceled due to conflicts with recovery in this database. (Conflicts occur only on standby servers; see pg_stat_database_conflicts for details.)", nil, nil},
+		"temp_files":               {COUNTER, "Number of temporary files created by queries in this database. All temporary files are counted, regardless of why the temporary file was created (e.g., sorting or hashing), and regardless of the log_temp_files setting.", nil, nil},
+		"temp_bytes":               {COUNTER, "Total amount of data written to temporary files by queries in this database. All temporary files are counted, regardless of why the temporary file was created, and regardless of the log_temp_files setting.", nil, nil},
+		"deadlocks":                {COUNTER, "Number of deadlocks detected in this database", nil, nil},
+		"blk_read_time":            {COUNTER, "Time spent reading data file blocks by backends in this database, in milliseconds", nil, nil},
+		"blk_write_time":           {COUNTER, "Time spent writing data file blocks by backends in this database, in milliseconds", nil, nil},
+		"session_time":             {COUNTER, "Time spent by database sessions in this database, in milliseconds", nil, mustParseVersionRange(">=14.0.0")},
+		"active_time":              {COUNTER, "Time spent executing SQL statements in this database, in milliseconds", nil, mustParseVersionRange(">=14.0.0")},
+		"idle_in_transaction_time": {COUNTER, "Time spent idling while in a transaction in this database, in milliseconds", nil, mustParseVersionRange(">=14.0.0")},
+		"sessions":                 {COUNTER, "Total number of sessions established to this database", nil, mustParseVersionRange(">=14.0.0")},
+		"sessions_abandoned":       {COUNTER, "Number of database sessions to this database that were terminated because connection to the client was lost", nil, mustParseVersionRange(">=14.0.0")},
+		"sessions_fatal":           {COUNTER, "Number of database sessions to this database that were terminated by fatal errors", nil, mustParseVersionRange(">=14.0.0")},
+		"sessions_killed":          {COUNTER, "Number of database sessions to this database that were terminated by operator intervention", nil, mustParseVersionRange(">=14.0.0")},
+		"checksum_failures":        {COUNTER, "Number of data page checksum failures detected in this database, or NaN if data checksums are not enabled", nil, mustParseVersionRange(">=12.0.0")},
+		"checksum_last_failure":    {GAUGE, "Time at which the last data page checksum failure was detected in this database, or NaN if there was none", nil, mustParseVersionRange(">=12.0.0")},
+		"stats_reset":              {RESETTIMESTAMP, "Time at which these statistics were last reset", nil, nil},
 	},
 	"pg_stat_database_conflicts": {
 		"datid":            {LABEL, "OID of a database", nil, nil},
@@ -214,6 +387,11 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 		"confl_snapshot":   {COUNTER, "Number of queries in this database that have been canceled due to old snapshots", nil, nil},
 		"confl_bufferpin":  {COUNTER, "Number of queries in this database that have been canceled due to pinned buffers", nil, nil},
 		"confl_deadlock":   {COUNTER, "Number of queries in this database that have been canceled due to deadlocks", nil, nil},
+
+		"confl_active_logicalslot": {COUNTER, "Number of uses of logical slots in this database that have been canceled due to old snapshots or too low a wal_level on the primary", nil, mustParseVersionRange(">=16.0.0")},
+	},
+	"pg_recovery_conflicts": {
+		"total": {COUNTER, "Number of queries canceled due to conflicts with recovery in all databases, only exported on standbys", nil, nil},
 	},
 	"pg_locks": {
 		"datname": {LABEL, "Name of this database", nil, nil},
@@ -221,8 +399,8 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 		"count":   {GAUGE, "Number of locks", nil, nil},
 	},
 	"pg_stat_replication": {
-		"procpid":                  {DISCARD, "Process ID of a WAL sender process", nil, semver.MustParseRange("<9.2.0")},
-		"pid":                      {DISCARD, "Process ID of a WAL sender process", nil, semver.MustParseRange(">=9.2.0")},
+		"procpid":                  {DISCARD, "Process ID of a WAL sender process", nil, mustParseVersionRange("<9.2.0")},
+		"pid":                      {DISCARD, "Process ID of a WAL sender process", nil, mustParseVersionRange(">=9.2.0")},
 		"usesysid":                 {DISCARD, "OID of the user logged into this WAL sender process", nil, nil},
 		"usename":                  {DISCARD, "Name of the user logged into this WAL sender process", nil, nil},
 		"application_name":         {DISCARD, "Name of the application that is connected to this WAL sender", nil, nil},
@@ -232,17 +410,17 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 		"backend_start":            {DISCARD, "with time zone	Time when this process was started, i.e., when the client connected to this WAL sender", nil, nil},
 		"backend_xmin":             {DISCARD, "The current backend's xmin horizon.", nil, nil},
 		"state":                    {LABEL, "Current WAL sender state", nil, nil},
-		"sent_location":            {DISCARD, "Last transaction log position sent on this connection", nil, semver.MustParseRange("<10.0.0")},
-		"write_location":           {DISCARD, "Last transaction log position written to disk by this standby server", nil, semver.MustParseRange("<10.0.0")},
-		"flush_location":           {DISCARD, "Last transaction log position flushed to disk by this standby server", nil, semver.MustParseRange("<10.0.0")},
-		"replay_location":          {DISCARD, "Last transaction log position replayed into the database on this standby server", nil, semver.MustParseRange("<10.0.0")},
-		"sent_lsn":                 {DISCARD, "Last transaction log position sent on this connection", nil, semver.MustParseRange(">=10.0.0")},
-		"write_lsn":                {DISCARD, "Last transaction log position written to disk by this standby server", nil, semver.MustParseRange(">=10.0.0")},
-		"flush_lsn":                {DISCARD, "Last transaction log position flushed to disk by this standby server", nil, semver.MustParseRange(">=10.0.0")},
-		"replay_lsn":               {DISCARD, "Last transaction log position replayed into the database on this standby server", nil, semver.MustParseRange(">=10.0.0")},
+		"sent_location":            {DISCARD, "Last transaction log position sent on this connection", nil, mustParseVersionRange("<10.0.0")},
+		"write_location":           {DISCARD, "Last transaction log position written to disk by this standby server", nil, mustParseVersionRange("<10.0.0")},
+		"flush_location":           {DISCARD, "Last transaction log position flushed to disk by this standby server", nil, mustParseVersionRange("<10.0.0")},
+		"replay_location":          {DISCARD, "Last transaction log position replayed into the database on this standby server", nil, mustParseVersionRange("<10.0.0")},
+		"sent_lsn":                 {DISCARD, "Last transaction log position sent on this connection", nil, mustParseVersionRange(">=10.0.0")},
+		"write_lsn":                {DISCARD, "Last transaction log position written to disk by this standby server", nil, mustParseVersionRange(">=10.0.0")},
+		"flush_lsn":                {DISCARD, "Last transaction log position flushed to disk by this standby server", nil, mustParseVersionRange(">=10.0.0")},
+		"replay_lsn":               {DISCARD, "Last transaction log position replayed into the database on this standby server", nil, mustParseVersionRange(">=10.0.0")},
 		"sync_priority":            {DISCARD, "Priority of this standby server for being chosen as the synchronous standby", nil, nil},
 		"sync_state":               {DISCARD, "Synchronous state of this standby server", nil, nil},
-		"slot_name":                {LABEL, "A unique, cluster-wide identifier for the replication slot", nil, semver.MustParseRange(">=9.2.0")},
+		"slot_name":                {LABEL, "A unique, cluster-wide identifier for the replication slot", nil, mustParseVersionRange(">=9.2.0")},
 		"plugin":                   {DISCARD, "The base name of the shared object containing the output plugin this logical slot is using, or null for physical slots", nil, nil},
 		"slot_type":                {DISCARD, "The slot type - physical or logical", nil, nil},
 		"datoid":                   {DISCARD, "The OID of the database this slot is associated with, or null. Only logical slots have an associated database", nil, nil},
@@ -253,20 +431,75 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 		"catalog_xmin":             {DISCARD, "The oldest transaction affecting the system catalogs that this slot needs the database to retain. VACUUM cannot remove catalog tuples deleted by any later transaction", nil, nil},
 		"restart_lsn":              {DISCARD, "The address (LSN) of oldest WAL which still might be required by the consumer of this slot and thus won't be automatically removed during checkpoints", nil, nil},
 		"pg_current_xlog_location": {DISCARD, "pg_current_xlog_location", nil, nil},
-		"pg_current_wal_lsn":       {DISCARD, "pg_current_xlog_location", nil, semver.MustParseRange(">=10.0.0")},
-		"pg_xlog_location_diff":    {GAUGE, "Lag in bytes between master and slave", nil, semver.MustParseRange(">=9.2.0 <10.0.0")},
-		"pg_wal_lsn_diff":          {GAUGE, "Lag in bytes between master and slave", nil, semver.MustParseRange(">=10.0.0")},
+		"pg_current_wal_lsn":       {DISCARD, "pg_current_xlog_location", nil, mustParseVersionRange(">=10.0.0")},
+		"pg_xlog_location_diff":    {GAUGE, "Lag in bytes between master and slave", nil, mustParseVersionRange(">=9.2.0 <10.0.0")},
+		"pg_wal_lsn_diff":          {GAUGE, "Lag in bytes between master and slave", nil, mustParseVersionRange(">=10.0.0")},
 		"confirmed_flush_lsn":      {DISCARD, "LSN position a consumer of a slot has confirmed flushing the data received", nil, nil},
-		"write_lag":                {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written it (but not yet flushed it or applied it). This can be used to gauge the delay that synchronous_commit level remote_write incurred while committing if this server was configured as a synchronous standby.", nil, semver.MustParseRange(">=10.0.0")},
-		"flush_lag":                {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written and flushed it (but not yet applied it). This can be used to gauge the delay that synchronous_commit level remote_flush incurred while committing if this server was configured as a synchronous standby.", nil, semver.MustParseRange(">=10.0.0")},
-		"replay_lag":               {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written, flushed and applied it. This can be used to gauge the delay that synchronous_commit level remote_apply incurred while committing if this server was configured as a synchronous standby.", nil, semver.MustParseRange(">=10.0.0")},
+		"write_lag":                {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written it (but not yet flushed it or applied it). This can be used to gauge the delay that synchronous_commit level remote_write incurred while committing if this server was configured as a synchronous standby.", nil, mustParseVersionRange(">=10.0.0")},
+		"flush_lag":                {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written and flushed it (but not yet applied it). This can be used to gauge the delay that synchronous_commit level remote_flush incurred while committing if this server was configured as a synchronous standby.", nil, mustParseVersionRange(">=10.0.0")},
+		"replay_lag":               {DISCARD, "Time elapsed between flushing recent WAL locally and receiving notification that this standby server has written, flushed and applied it. This can be used to gauge the delay that synchronous_commit level remote_apply incurred while committing if this server was configured as a synchronous standby.", nil, mustParseVersionRange(">=10.0.0")},
 	},
 	"pg_stat_activity": {
 		"datname":         {LABEL, "Name of this database", nil, nil},
-		"state":           {LABEL, "connection state", nil, semver.MustParseRange(">=9.2.0")},
+		"state":           {LABEL, "connection state", nil, mustParseVersionRange(">=9.2.0")},
 		"count":           {GAUGE, "number of connections in this state", nil, nil},
 		"max_tx_duration": {GAUGE, "max duration in seconds any active transaction has been running", nil, nil},
 	},
+	"pg_stat_activity_idle": {
+		"datname":     {LABEL, "Name of this database", nil, nil},
+		"connections": {GAUGE, "Number of connections idle outside of a transaction, which a pool could reclaim", nil, nil},
+	},
+	"pg_replay_lag": {
+		"bytes": {GAUGE, "Lag in bytes between the WAL received and the WAL replayed by this standby", nil, nil},
+	},
+	"pg_autovacuum": {
+		"enabled": {GAUGE, "Whether autovacuum is enabled, which also requires track_counts to be on (1 = enabled, 0 = disabled)", nil, nil},
+	},
+	"pg_replication_slot_lag": {
+		"slot_name": {LABEL, "A unique, cluster-wide identifier for the replication slot", nil, nil},
+		"slot_type": {LABEL, "The slot type - physical or logical", nil, nil},
+		"seconds":   {GAUGE, "Time elapsed between flushing recent WAL locally and the consumer of this logical slot applying it, NaN if the slot is not active", nil, nil},
+	},
+	"pg_logical_slot": {
+		"slot_name": {LABEL, "A unique, cluster-wide identifier for the replication slot", nil, nil},
+		"plugin":    {LABEL, "The base name of the shared object containing the output plugin this logical slot is using", nil, nil},
+		"lag_bytes": {GAUGE, "Bytes of WAL the consumer of this logical slot has not confirmed flushing yet, only exported on primaries", nil, nil},
+	},
+	"pg_replication_slot_inactive": {
+		"slot_name": {LABEL, "A unique, cluster-wide identifier for the replication slot", nil, nil},
+		"seconds":   {GAUGE, "Seconds since this replication slot became inactive", nil, nil},
+	},
+	"pg_wal_senders": {
+		"active": {GAUGE, "Number of WAL sender processes streaming to standbys or logical replication clients", nil, nil},
+	},
+	"pg_wal_receiver": {
+		"active": {GAUGE, "Whether a WAL receiver process is streaming to this standby (1 = yes, 0 = no), only exported on standbys", nil, nil},
+	},
+	"pg_control": {
+		"timeline_id": {GAUGE, "Timeline of the latest checkpoint, which increments on each promotion", nil, nil},
+	},
+	"pg_connections": {
+		"available": {GAUGE, "Number of connections clients without reserved slots can still open: max_connections less the reserved connections and the current client backends", nil, nil},
+	},
+	"pg_archiver": {
+		"seconds_since_last_archive": {GAUGE, "Seconds since the last WAL file was successfully archived, NaN if none ever was", nil, nil},
+	},
+}
+
+// versionRange is a semver.Range which keeps the text it was parsed from, so
+// the maps can be dumped.
+type versionRange struct {
+	contains semver.Range
+	text     string
+}
+
+// mustParseVersionRange is like semver.MustParseRange.
+func mustParseVersionRange(s string) *versionRange {
+	return &versionRange{contains: semver.MustParseRange(s), text: s}
+}
+
+func (r *versionRange) String() string {
+	return r.text
 }
 
 // OverrideQuery 's are run in-place of simple namespace look ups, and provide
@@ -274,16 +507,52 @@ var builtinMetricMaps = map[string]map[string]ColumnMapping{
 // There aren't too many versions, so we simply store customized versions using
 // the semver matching we do for columns.
 type OverrideQuery struct {
-	versionRange semver.Range
+	versionRange *versionRange
 	query        string
 }
 
 // Overriding queries for namespaces above.
 // TODO: validate this is a closed set in tests, and there are no overlaps
 var queryOverrides = map[string][]OverrideQuery{
+	"pg_stat_bgwriter": {
+		{
+			mustParseVersionRange("<17.0.0"),
+			`SELECT * FROM pg_stat_bgwriter`,
+		},
+		{
+			// The backend writes and fsyncs of pg_stat_io are those of shared
+			// buffers by processes other than the background writer and
+			// checkpointer, which pg_stat_bgwriter counted. stats_reset
+			// remains that of pg_stat_bgwriter.
+			mustParseVersionRange(">=17.0.0"),
+			`
+			SELECT
+				c.num_timed AS checkpoints_timed,
+				c.num_requested AS checkpoints_req,
+				c.write_time AS checkpoint_write_time,
+				c.sync_time AS checkpoint_sync_time,
+				c.buffers_written AS buffers_checkpoint,
+				b.buffers_clean,
+				b.maxwritten_clean,
+				io.writes AS buffers_backend,
+				io.fsyncs AS buffers_backend_fsync,
+				b.buffers_alloc,
+				b.stats_reset
+			FROM pg_stat_bgwriter b
+			CROSS JOIN pg_stat_checkpointer c
+			CROSS JOIN (
+				SELECT COALESCE(sum(writes), 0) AS writes, COALESCE(sum(fsyncs), 0) AS fsyncs
+				FROM pg_stat_io
+				WHERE object = 'relation'
+					AND backend_type NOT IN ('background writer', 'checkpointer')
+			) io
+			`,
+		},
+	},
+
 	"pg_locks": {
 		{
-			semver.MustParseRange(">0.0.0"),
+			mustParseVersionRange(">0.0.0"),
 			`SELECT pg_database.datname,tmp.mode,COALESCE(count,0) as count
 			FROM
 				(
@@ -307,7 +576,7 @@ var queryOverrides = map[string][]OverrideQuery{
 
 	"pg_stat_replication": {
 		{
-			semver.MustParseRange(">=10.0.0"),
+			mustParseVersionRange(">=10.0.0"),
 			`
 			SELECT *,
 				(case pg_is_in_recovery() when 't' then null else pg_current_wal_lsn() end) AS pg_current_wal_lsn,
@@ -316,7 +585,7 @@ var queryOverrides = map[string][]OverrideQuery{
 			`,
 		},
 		{
-			semver.MustParseRange(">=9.2.0 <10.0.0"),
+			mustParseVersionRange(">=9.2.0 <10.0.0"),
 			`
 			SELECT *,
 				(case pg_is_in_recovery() when 't' then null else pg_current_xlog_location() end) AS pg_current_xlog_location,
@@ -325,7 +594,7 @@ var queryOverrides = map[string][]OverrideQuery{
 			`,
 		},
 		{
-			semver.MustParseRange("<9.2.0"),
+			mustParseVersionRange("<9.2.0"),
 			`
 			SELECT *,
 				(case pg_is_in_recovery() when 't' then null else pg_current_xlog_location() end) AS pg_current_xlog_location
@@ -337,7 +606,7 @@ var queryOverrides = map[string][]OverrideQuery{
 	"pg_stat_activity": {
 		// This query only works
 		{
-			semver.MustParseRange(">=9.2.0"),
+			mustParseVersionRange(">=9.2.0"),
 			`
 			SELECT
 				pg_database.datname,
@@ -366,6 +635,187 @@ var queryOverrides = map[string][]OverrideQuery{
 		},
 		// No query is applicable for 9.1 that gives any sensible data.
 	},
+
+	"pg_stat_activity_idle": {
+		// Unlike idle in transaction, plain idle connections hold no
+		// snapshot or locks.
+		{
+			mustParseVersionRange(">=9.2.0"),
+			`
+			SELECT pg_database.datname, count(pg_stat_activity.state) AS connections
+			FROM pg_database
+			LEFT JOIN pg_stat_activity
+				ON pg_stat_activity.datname = pg_database.datname AND pg_stat_activity.state = 'idle'
+			GROUP BY pg_database.datname
+			`,
+		},
+	},
+
+	"pg_replay_lag": {
+		// Only returns a row on standbys which have received WAL.
+		{
+			mustParseVersionRange(">=10.0.0"),
+			`
+			SELECT pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn())::float AS bytes
+			WHERE pg_is_in_recovery() AND pg_last_wal_receive_lsn() IS NOT NULL
+			`,
+		},
+		{
+			mustParseVersionRange(">=9.2.0 <10.0.0"),
+			`
+			SELECT pg_xlog_location_diff(pg_last_xlog_receive_location(), pg_last_xlog_replay_location())::float AS bytes
+			WHERE pg_is_in_recovery() AND pg_last_xlog_receive_location() IS NOT NULL
+			`,
+		},
+	},
+
+	"pg_autovacuum": {
+		{
+			mustParseVersionRange(">0.0.0"),
+			`SELECT (current_setting('autovacuum')::bool AND current_setting('track_counts')::bool)::int AS enabled`,
+		},
+	},
+
+	"pg_replication_slot_lag": {
+		// The lag columns of pg_stat_replication were added in 10. They are
+		// NULL once the consumer has caught up and stays idle.
+		{
+			mustParseVersionRange(">=10.0.0"),
+			`
+			SELECT
+				s.slot_name,
+				s.slot_type,
+				CASE WHEN r.pid IS NULL THEN NULL ELSE COALESCE(EXTRACT(EPOCH FROM r.replay_lag), 0) END AS seconds
+			FROM pg_replication_slots s
+			LEFT JOIN pg_stat_replication r ON r.pid = s.active_pid
+			WHERE s.slot_type = 'logical'
+			`,
+		},
+	},
+
+	"pg_logical_slot": {
+		// confirmed_flush_lsn was added in 9.6. The current WAL position is
+		// not available during recovery, so standbys return no rows.
+		{
+			mustParseVersionRange(">=9.6.0 <10.0.0"),
+			`
+			SELECT slot_name, plugin, pg_xlog_location_diff(pg_current_xlog_location(), confirmed_flush_lsn)::float AS lag_bytes
+			FROM pg_replication_slots
+			WHERE slot_type = 'logical' AND NOT pg_is_in_recovery()
+			`,
+		},
+		{
+			mustParseVersionRange(">=10.0.0"),
+			`
+			SELECT slot_name, plugin, pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn)::float AS lag_bytes
+			FROM pg_replication_slots
+			WHERE slot_type = 'logical' AND NOT pg_is_in_recovery()
+			`,
+		},
+	},
+
+	"pg_replication_slot_inactive": {
+		// inactive_since was added in 17. It is NULL for active slots, which
+		// are skipped.
+		{
+			mustParseVersionRange(">=17.0.0"),
+			`
+			SELECT slot_name, EXTRACT(EPOCH FROM now() - inactive_since) AS seconds
+			FROM pg_replication_slots
+			WHERE inactive_since IS NOT NULL
+			`,
+		},
+	},
+
+	"pg_stat_wal": {
+		// pg_stat_wal was added in 14
+		{
+			mustParseVersionRange(">=14.0.0"),
+			`SELECT * FROM pg_stat_wal`,
+		},
+	},
+
+	"pg_recovery_conflicts": {
+		// HAVING drops the single row of the aggregate on primaries.
+		{
+			mustParseVersionRange(">=9.1.0 <16.0.0"),
+			`
+			SELECT sum(confl_tablespace + confl_lock + confl_snapshot + confl_bufferpin + confl_deadlock)::float AS total
+			FROM pg_stat_database_conflicts
+			HAVING pg_is_in_recovery()
+			`,
+		},
+		{
+			mustParseVersionRange(">=16.0.0"),
+			`
+			SELECT sum(confl_tablespace + confl_lock + confl_snapshot + confl_bufferpin + confl_deadlock + confl_active_logicalslot)::float AS total
+			FROM pg_stat_database_conflicts
+			HAVING pg_is_in_recovery()
+			`,
+		},
+	},
+
+	"pg_wal_senders": {
+		{
+			mustParseVersionRange(">=9.1.0"),
+			`SELECT count(*) AS active FROM pg_stat_replication`,
+		},
+	},
+
+	"pg_wal_receiver": {
+		// pg_stat_wal_receiver was added in 9.6, it has no row unless a WAL
+		// receiver runs. HAVING drops the single row of the aggregate on
+		// primaries.
+		{
+			mustParseVersionRange(">=9.6.0"),
+			`SELECT (count(*) > 0)::int AS active FROM pg_stat_wal_receiver HAVING pg_is_in_recovery()`,
+		},
+	},
+
+	"pg_control": {
+		// pg_control_checkpoint was added in 9.6.
+		{
+			mustParseVersionRange(">=9.6.0"),
+			`SELECT timeline_id FROM pg_control_checkpoint()`,
+		},
+	},
+
+	"pg_connections": {
+		// Before 10 pg_stat_activity only lists client backends. 16 added
+		// reserved_connections, for roles with pg_use_reserved_connections.
+		{
+			mustParseVersionRange(">=9.1.0 <10.0.0"),
+			`
+			SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int - count(*) AS available
+			FROM pg_stat_activity
+			`,
+		},
+		{
+			mustParseVersionRange(">=10.0.0 <16.0.0"),
+			`
+			SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int - count(*) AS available
+			FROM pg_stat_activity
+			WHERE backend_type = 'client backend'
+			`,
+		},
+		{
+			mustParseVersionRange(">=16.0.0"),
+			`
+			SELECT current_setting('max_connections')::int - current_setting('superuser_reserved_connections')::int - current_setting('reserved_connections')::int - count(*) AS available
+			FROM pg_stat_activity
+			WHERE backend_type = 'client backend'
+			`,
+		},
+	},
+
+	"pg_archiver": {
+		// pg_stat_archiver was added in 9.4. last_archived_time is NULL,
+		// exported as NaN, if no WAL file was ever archived.
+		{
+			mustParseVersionRange(">=9.4.0"),
+			`SELECT EXTRACT(EPOCH FROM now() - last_archived_time) AS seconds_since_last_archive FROM pg_stat_archiver`,
+		},
+	},
 }
 
 // Convert the query override file to the version-specific query override file
@@ -377,7 +827,7 @@ func makeQueryOverrideMap(pgVersion semver.Version, queryOverrides map[string][]
 		// ranges at test-time, so only 1 should ever match.
 		matched := false
 		for _, queryDef := range overrideDef {
-			if queryDef.versionRange(pgVersion) {
+			if queryDef.versionRange.contains(pgVersion) {
 				resultMap[name] = queryDef.query
 				matched = true
 				break
@@ -392,6 +842,21 @@ func makeQueryOverrideMap(pgVersion semver.Version, queryOverrides map[string][]
 	return resultMap
 }
 
+// How custom queries are merged with namespaces which are already defined.
+const (
+	// The custom namespace replaces the existing one
+	userQueriesReplace = "replace"
+	// The columns of the custom namespace are merged over the existing ones
+	userQueriesPrepend = "prepend"
+	// The existing namespace is kept and the custom one added alongside it,
+	// as the namespace suffixed with userQueriesAppendSuffix
+	userQueriesAppend = "append"
+)
+
+// userQueriesAppendSuffix suffixes the namespace of custom queries appended
+// to an existing namespace, giving their metrics distinct names.
+const userQueriesAppendSuffix = "_user"
+
 // Add queries to the builtinMetricMaps and queryOverrides maps. Added queries do not
 // respect version requirements, because it is assumed that the user knows
 // what they are doing with their version of postgres.
@@ -401,7 +866,7 @@ func makeQueryOverrideMap(pgVersion semver.Version, queryOverrides map[string][]
 // TODO: test code for all cu.
 // TODO: use proper struct type system
 // TODO: the YAML this supports is "non-standard" - we should move away from it.
-func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string]MetricMapNamespace, queryOverrideMap map[string]string) error {
+func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string]MetricMapNamespace, queryOverrideMap map[string]string, priority string) error {
 	var extra map[string]interface{}
 
 	err := yaml.Unmarshal(content, &extra)
@@ -412,6 +877,35 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 	// Stores the loaded map representation
 	metricMaps := make(map[string]map[string]ColumnMapping)
 	newQueryOverrides := make(map[string]string)
+	newSearchPaths := make(map[string]string)
+	newForEachSchemas := make(map[string]string)
+	newSummaries := make(map[string]map[string]summaryColumns)
+	newEmitZeroOnEmpty := make(map[string]bool)
+	newPreferReplica := make(map[string]bool)
+	newStaticLabels := make(map[string]prometheus.Labels)
+	newTags := make(map[string][]string)
+
+	// Appended namespaces are loaded under their own name, running their
+	// query, or that of the existing namespace, alongside the existing one
+	appended := make(map[string]string)
+	if priority == userQueriesAppend {
+		for metric := range extra {
+			if _, found := exporterMap[metric]; found {
+				appended[metric+userQueriesAppendSuffix] = metric
+			}
+		}
+		for name, metric := range appended {
+			if _, found := exporterMap[name]; found {
+				return fmt.Errorf("%s: cannot append to the existing namespace, %s is defined already", metric, name)
+			}
+			if _, found := extra[name]; found {
+				return fmt.Errorf("%s: cannot append to the existing namespace, %s is defined already", metric, name)
+			}
+			log.Infoln("Adding metric", metric, "from user YAML file alongside the existing one, as", name)
+			extra[name] = extra[metric]
+			delete(extra, metric)
+		}
+	}
 
 	for metric, specs := range extra {
 		log.Debugln("New user metric namespace from YAML:", metric)
@@ -421,6 +915,33 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 				query := value.(string)
 				newQueryOverrides[metric] = query
 
+			case "search_path":
+				newSearchPaths[metric] = value.(string)
+
+			case "for_each_schema":
+				newForEachSchemas[metric] = value.(string)
+
+			case "emit_zero_on_empty":
+				emit, err := parseBool("emit_zero_on_empty", value)
+				if err != nil {
+					return fmt.Errorf("%s: %s", metric, err)
+				}
+				newEmitZeroOnEmpty[metric] = emit
+
+			case "prefer_replica":
+				prefer, err := parseBool("prefer_replica", value)
+				if err != nil {
+					return fmt.Errorf("%s: %s", metric, err)
+				}
+				newPreferReplica[metric] = prefer
+
+			case "tags":
+				tags, err := parseTags(value)
+				if err != nil {
+					return fmt.Errorf("%s: %s", metric, err)
+				}
+				newTags[metric] = tags
+
 			case "metrics":
 				for _, c := range value.([]interface{}) {
 					column := c.(map[interface{}]interface{})
@@ -438,6 +959,7 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 
 						// Get name.
 						name := n.(string)
+						summary := summaryColumns{sum: name + "_sum", count: name + "_count"}
 
 						for attrKey, attrVal := range a.(map[interface{}]interface{}) {
 							switch attrKey.(string) {
@@ -449,11 +971,49 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 								columnMapping.usage = usage
 							case "description":
 								columnMapping.description = attrVal.(string)
+							case "quantiles":
+								quantiles, err := parseSummaryQuantiles(attrVal)
+								if err != nil {
+									return fmt.Errorf("%s.%s: %s", metric, name, err)
+								}
+								summary.quantiles = quantiles
+							case "buckets":
+								buckets, err := parseHistogramBuckets(attrVal)
+								if err != nil {
+									return fmt.Errorf("%s.%s: %s", metric, name, err)
+								}
+								summary.buckets = buckets
+							case "labels":
+								labels, err := parseStaticLabels(attrVal)
+								if err != nil {
+									return fmt.Errorf("%s.%s: %s", metric, name, err)
+								}
+								newStaticLabels[metric+"."+name] = labels
+							case "sum":
+								summary.sum = fmt.Sprint(attrVal)
+							case "count":
+								summary.count = fmt.Sprint(attrVal)
+							case "metric_mapping":
+								mapping, err := parseMetricMapping(attrVal)
+								if err != nil {
+									return fmt.Errorf("%s.%s: %s", metric, name, err)
+								}
+								columnMapping.mapping = mapping
+							}
+						}
+
+						if columnMapping.usage == MAPPEDMETRIC && len(columnMapping.mapping) == 0 {
+							return fmt.Errorf("%s.%s: MAPPEDMETRIC usage requires a metric_mapping", metric, name)
+						}
+
+						if columnMapping.usage == SUMMARY || columnMapping.usage == HISTOGRAM {
+							summary.histogram = columnMapping.usage == HISTOGRAM
+							if newSummaries[metric] == nil {
+								newSummaries[metric] = make(map[string]summaryColumns)
 							}
+							newSummaries[metric][name] = summary
 						}
 
-						// TODO: we should support cu
-						columnMapping.mapping = nil
 						// Should we support this for users?
 						columnMapping.supportedVersions = nil
 
@@ -464,16 +1024,117 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 		}
 	}
 
+	for name, metric := range appended {
+		if _, ok := newQueryOverrides[name]; ok {
+			continue
+		}
+		if query, ok := queryOverrideMap[metric]; ok {
+			newQueryOverrides[name] = query
+		} else {
+			newQueryOverrides[name] = defaultNamespaceQuery(metric)
+		}
+	}
+
+	// Queries run in each matching schema get the schema as an extra label
+	for metric := range newForEachSchemas {
+		if metricMap, ok := metricMaps[metric]; ok {
+			metricMap[schemaLabel] = ColumnMapping{LABEL, "Schema the query was run in", nil, nil}
+		}
+	}
+
+	// A LABEL column takes precedence over a static label of the same name
+	for column, labels := range newStaticLabels {
+		metric := column[:strings.Index(column, ".")]
+		for name := range labels {
+			if metricMaps[metric][name].usage == LABEL {
+				log.Warnln("Ignoring static label", name, "of", column, "from user YAML file, it is a LABEL column of the query.")
+				delete(labels, name)
+			}
+		}
+	}
+
 	// Convert the loaded metric map into exporter representation
-	partialExporterMap := makeDescMap(pgVersion, metricMaps)
+	partialExporterMap := makeDescMap(pgVersion, metricMaps, descMapOptions{labels: newStaticLabels})
+	for k, v := range newSearchPaths {
+		if namespaceMap, ok := partialExporterMap[k]; ok {
+			namespaceMap.searchPath = v
+			partialExporterMap[k] = namespaceMap
+		}
+	}
+	for k, v := range newForEachSchemas {
+		if namespaceMap, ok := partialExporterMap[k]; ok {
+			namespaceMap.forEachSchema = v
+			partialExporterMap[k] = namespaceMap
+		}
+	}
+	for k, v := range newPreferReplica {
+		if namespaceMap, ok := partialExporterMap[k]; ok {
+			namespaceMap.preferReplica = v
+			partialExporterMap[k] = namespaceMap
+		}
+	}
+	for k, v := range newTags {
+		if namespaceMap, ok := partialExporterMap[k]; ok {
+			namespaceMap.tags = v
+			partialExporterMap[k] = namespaceMap
+		}
+	}
+	for k, v := range newEmitZeroOnEmpty {
+		namespaceMap, ok := partialExporterMap[k]
+		if !ok || !v {
+			continue
+		}
+		// Without rows there are no label values to emit the metrics with
+		if len(namespaceMap.labels) > 0 {
+			return fmt.Errorf("%s: emit_zero_on_empty only applies to queries without label columns", k)
+		}
+		namespaceMap.emitZeroOnEmpty = true
+		partialExporterMap[k] = namespaceMap
+	}
+	for k, v := range newSummaries {
+		namespaceMap, ok := partialExporterMap[k]
+		if !ok {
+			continue
+		}
+		namespaceMap.summaries = v
+		// The columns summaries are built from are not metrics of their own
+		for _, summary := range v {
+			for _, column := range summary.columns() {
+				if _, defined := namespaceMap.columnMappings[column]; !defined {
+					namespaceMap.columnMappings[column] = MetricMap{discard: true}
+				}
+			}
+		}
+		partialExporterMap[k] = namespaceMap
+	}
 
 	// Merge the two maps (which are now quite flatteend)
 	for k, v := range partialExporterMap {
-		_, found := exporterMap[k]
-		if found {
-			log.Debugln("Overriding metric", k, "from user YAML file.")
-		} else {
+		v.userQuery = true
+		existing, found := exporterMap[k]
+		if !found {
 			log.Debugln("Adding new metric", k, "from user YAML file.")
+			exporterMap[k] = v
+			continue
+		}
+
+		switch priority {
+		case userQueriesPrepend:
+			if !reflect.DeepEqual(existing.labels, v.labels) {
+				log.Infoln("Overriding metric", k, "from user YAML file, its labels differ from the existing ones so the columns cannot be merged.")
+				break
+			}
+			log.Infoln("Merging metric", k, "from user YAML file over the existing one.")
+			columnMappings := make(map[string]MetricMap, len(existing.columnMappings)+len(v.columnMappings))
+			for column, m := range existing.columnMappings {
+				columnMappings[column] = m
+			}
+			for column, m := range v.columnMappings {
+				columnMappings[column] = m
+			}
+			v.columnMappings = columnMappings
+		default:
+			log.Infoln("Overriding metric", k, "from user YAML file.")
 		}
 		exporterMap[k] = v
 	}
@@ -492,12 +1153,26 @@ func addQueries(content []byte, pgVersion semver.Version, exporterMap map[string
 	return nil
 }
 
+// descMapOptions adjusts the metrics makeDescMap builds.
+type descMapOptions struct {
+	renames map[string]string            // New metric name prefix of namespaces
+	usages  map[string]ColumnUsage       // Usage overriding the one of namespace.column
+	labels  map[string]prometheus.Labels // Static labels of namespace.column
+	names   map[string]string            // Metric name of namespace.column, instead of prefix_column
+	// Column whose change between scrapes divides that of namespace.column
+	averages map[string]string
+}
+
 // Turn the MetricMap column mapping into a prometheus descriptor mapping.
-func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]ColumnMapping) map[string]MetricMapNamespace {
+func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]ColumnMapping, opts descMapOptions) map[string]MetricMapNamespace {
 	var metricMap = make(map[string]MetricMapNamespace)
 
 	for namespace, mappings := range metricMaps {
 		thisMap := make(map[string]MetricMap)
+		prefix := namespace
+		if to, ok := opts.renames[namespace]; ok {
+			prefix = to
+		}
 
 		// Get the constant labels
 		var constLabels []string
@@ -506,12 +1181,14 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 				constLabels = append(constLabels, columnName)
 			}
 		}
+		// Map iteration order is random, sort so descriptors are stable
+		sort.Strings(constLabels)
 
 		for columnName, columnMapping := range mappings {
 			// Check column version compatibility for the current map
 			// Force to discard if not compatible.
 			if columnMapping.supportedVersions != nil {
-				if !columnMapping.supportedVersions(pgVersion) {
+				if !columnMapping.supportedVersions.contains(pgVersion) {
 					// It's very useful to be able to see what columns are being
 					// rejected.
 					log.Debugln(columnName, "is being forced to discard due to version incompatibility.")
@@ -525,6 +1202,15 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 				}
 			}
 
+			if usage, ok := opts.usages[namespace+"."+columnName]; ok {
+				columnMapping.usage = usage
+			}
+			staticLabels := opts.labels[namespace+"."+columnName]
+			name := prefix + "_" + columnName
+			if fixed, ok := opts.names[namespace+"."+columnName]; ok {
+				name = fixed
+			}
+
 			// Determine how to convert the column based on its usage.
 			// nolint: dupl
 			switch columnMapping.usage {
@@ -538,7 +1224,26 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 			case COUNTER:
 				thisMap[columnName] = MetricMap{
 					vtype: prometheus.CounterValue,
-					desc:  prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, columnName), columnMapping.description, constLabels, nil),
+					desc:  prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
+					conversion: func(in interface{}) (float64, bool) {
+						return dbToFloat64(in)
+					},
+				}
+			case COUNTERRESETTABLE:
+				thisMap[columnName] = MetricMap{
+					vtype:  prometheus.CounterValue,
+					desc:   prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
+					resets: prometheus.NewDesc(name+"_resets_total", fmt.Sprintf("Number of times %s decreased between scrapes", name), constLabels, staticLabels),
+					conversion: func(in interface{}) (float64, bool) {
+						return dbToFloat64(in)
+					},
+				}
+			case RESETTIMESTAMP:
+				thisMap[columnName] = MetricMap{
+					vtype:    prometheus.GaugeValue,
+					desc:     prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
+					resets:   prometheus.NewDesc(name+"_total", fmt.Sprintf("Number of times %s changed between scrapes", name), constLabels, staticLabels),
+					onChange: true,
 					conversion: func(in interface{}) (float64, bool) {
 						return dbToFloat64(in)
 					},
@@ -546,7 +1251,7 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 			case GAUGE:
 				thisMap[columnName] = MetricMap{
 					vtype: prometheus.GaugeValue,
-					desc:  prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, columnName), columnMapping.description, constLabels, nil),
+					desc:  prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
 					conversion: func(in interface{}) (float64, bool) {
 						return dbToFloat64(in)
 					},
@@ -554,10 +1259,15 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 			case MAPPEDMETRIC:
 				thisMap[columnName] = MetricMap{
 					vtype: prometheus.GaugeValue,
-					desc:  prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, columnName), columnMapping.description, constLabels, nil),
+					desc:  prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
 					conversion: func(in interface{}) (float64, bool) {
-						text, ok := in.(string)
-						if !ok {
+						var text string
+						switch t := in.(type) {
+						case []byte:
+							text = string(t)
+						case string:
+							text = t
+						default:
 							return math.NaN(), false
 						}
 
@@ -571,7 +1281,7 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 			case DURATION:
 				thisMap[columnName] = MetricMap{
 					vtype: prometheus.GaugeValue,
-					desc:  prometheus.NewDesc(fmt.Sprintf("%s_%s_milliseconds", namespace, columnName), columnMapping.description, constLabels, nil),
+					desc:  prometheus.NewDesc(name+"_milliseconds", columnMapping.description, constLabels, staticLabels),
 					conversion: func(in interface{}) (float64, bool) {
 						var durationString string
 						switch t := in.(type) {
@@ -580,15 +1290,19 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 						case string:
 							durationString = t
 						default:
-							log.Errorln("DURATION conversion metric was not a string")
-							return math.NaN(), false
+							// NULL, or a number already in milliseconds
+							return dbToFloat64(in)
 						}
 
 						if durationString == "-1" {
-							return math.NaN(), false
+							return math.NaN(), true
 						}
 
+						// Go durations, e.g. from settings, or PostgreSQL intervals
 						d, err := time.ParseDuration(durationString)
+						if err != nil {
+							d, err = parseInterval(durationString)
+						}
 						if err != nil {
 							log.Errorln("Failed converting result to metric:", columnName, in, err)
 							return math.NaN(), false
@@ -596,10 +1310,26 @@ func makeDescMap(pgVersion semver.Version, metricMaps map[string]map[string]Colu
 						return float64(d / time.Millisecond), true
 					},
 				}
-			}
-		}
-
-		metricMap[namespace] = MetricMapNamespace{constLabels, thisMap}
+			case SUMMARY, HISTOGRAM:
+				// Not a column of the query, the summary or histogram is
+				// emitted from the columns it names instead.
+				thisMap[columnName] = MetricMap{
+					discard: true,
+					desc:    prometheus.NewDesc(name, columnMapping.description, constLabels, staticLabels),
+					conversion: func(_ interface{}) (float64, bool) {
+						return math.NaN(), true
+					},
+				}
+			}
+
+			if over, ok := opts.averages[namespace+"."+columnName]; ok {
+				m := thisMap[columnName]
+				m.average = over
+				thisMap[columnName] = m
+			}
+		}
+
+		metricMap[namespace] = MetricMapNamespace{labels: constLabels, prefix: prefix, columnMappings: thisMap}
 	}
 
 	return metricMap
@@ -628,6 +1358,18 @@ func stringToColumnUsage(s string) (ColumnUsage, error) {
 	case "DURATION":
 		u = DURATION
 
+	case "SUMMARY":
+		u = SUMMARY
+
+	case "HISTOGRAM":
+		u = HISTOGRAM
+
+	case "COUNTER_RESETTABLE":
+		u = COUNTERRESETTABLE
+
+	case "RESET_TIMESTAMP":
+		u = RESETTIMESTAMP
+
 	default:
 		err = fmt.Errorf("wrong ColumnUsage given : %s", s)
 	}
@@ -635,6 +1377,33 @@ func stringToColumnUsage(s string) (ColumnUsage, error) {
 	return u, err
 }
 
+// String returns the name of the usage in the queries file.
+func (cu ColumnUsage) String() string {
+	switch cu {
+	case DISCARD:
+		return "DISCARD"
+	case LABEL:
+		return "LABEL"
+	case COUNTER:
+		return "COUNTER"
+	case GAUGE:
+		return "GAUGE"
+	case MAPPEDMETRIC:
+		return "MAPPEDMETRIC"
+	case DURATION:
+		return "DURATION"
+	case SUMMARY:
+		return "SUMMARY"
+	case HISTOGRAM:
+		return "HISTOGRAM"
+	case COUNTERRESETTABLE:
+		return "COUNTER_RESETTABLE"
+	case RESETTIMESTAMP:
+		return "RESET_TIMESTAMP"
+	}
+	return fmt.Sprintf("ColumnUsage(%d)", int(cu))
+}
+
 // Convert database.sql types to float64s for Prometheus consumption. Null types are mapped to NaN. string and []byte
 // types are mapped as NaN and !ok
 func dbToFloat64(t interface{}) (float64, bool) {
@@ -643,6 +1412,11 @@ func dbToFloat64(t interface{}) (float64, bool) {
 		return float64(v), true
 	case float64:
 		return v, true
+	case bool:
+		if v {
+			return 1.0, true
+		}
+		return 0.0, true
 	case time.Time:
 		return float64(v.Unix()), true
 	case []byte:
@@ -675,6 +1449,11 @@ func dbToString(t interface{}) (string, bool) {
 		return fmt.Sprintf("%v", v), true
 	case float64:
 		return fmt.Sprintf("%v", v), true
+	case bool:
+		if v {
+			return "true", true
+		}
+		return "false", true
 	case time.Time:
 		return fmt.Sprintf("%v", v.Unix()), true
 	case nil:
@@ -695,19 +1474,60 @@ type Exporter struct {
 	// only, since it just points to the global.
 	builtinMetricMaps map[string]map[string]ColumnMapping
 
-	dsn                   string
-	disableDefaultMetrics bool
-	userQueriesPath       string
-	duration              prometheus.Gauge
-	error                 prometheus.Gauge
-	psqlUp                prometheus.Gauge
-	userQueriesError      *prometheus.GaugeVec
-	totalScrapes          prometheus.Counter
+	dsn                       string
+	disableDefaultMetrics     bool
+	userQueriesPath           string
+	userQueriesPriority       string
+	searchPath                string
+	collectors                []string
+	compat                    string
+	tablespacePaths           map[string]string
+	connectTimeout            time.Duration
+	queryTimeout              time.Duration
+	maxConnectionAge          time.Duration
+	maxOpenConns              int
+	maxIdleConns              int
+	setRole                   string
+	exitOnDBUnreachable       time.Duration
+	maintenanceFile           string
+	maintenanceSuppressErrors bool
+	debugMetrics              bool
+	queryFilters              map[string]string
+	queryLimits               map[string]int64
+	extraQueryOverrides       map[string]string
+	descMapOptions            descMapOptions
+	dropColumns               map[string][]string
+	replicaDSN                string
+	replicaNamespaces         map[string]bool
+
+	// replicaConnection is the connection to the replica, if any, and
+	// replicaPinged when it was last pinged; both are guarded by replicaMtx
+	replicaConnection *sql.DB
+	replicaPinged     time.Time
+	replicaMtx        sync.Mutex
+
+	// lastConnected is when a scrape last connected to the database, or
+	// when the exporter was created
+	lastConnected    time.Time
+	nullLabelValue   string
+	duration         prometheus.Gauge
+	error            prometheus.Gauge
+	psqlUp           prometheus.Gauge
+	userQueriesError *prometheus.GaugeVec
+	totalScrapes     prometheus.Counter
+	counterResets    *counterResets
+
+	lastReloadSuccessful       prometheus.Gauge
+	lastReloadSuccessTimestamp prometheus.Gauge
+	maintenanceMode            prometheus.Gauge
 
 	// dbDsn is the connection string used to establish the dbConnection
 	dbDsn string
 	// dbConnection is used to allow re-using the DB connection between scrapes
 	dbConnection *sql.DB
+	// connMtx guards dbDsn, dbConnection and lastConnected, which concurrent
+	// scrapes share
+	connMtx sync.Mutex
 
 	// Last version used to calculate metric map. If mismatch on scrape,
 	// then maps are recalculated.
@@ -717,15 +1537,217 @@ type Exporter struct {
 	// Currently active query overrides
 	queryOverrides map[string]string
 	mappingMtx     sync.RWMutex
+
+	// suppressMtx serializes scrapes when maintenanceSuppressErrors is set
+	suppressMtx sync.Mutex
+}
+
+// ExporterOpt configures Exporter.
+type ExporterOpt func(*Exporter)
+
+// DisableDefaultMetrics configures default metrics export.
+func DisableDefaultMetrics(b bool) ExporterOpt {
+	return func(e *Exporter) {
+		e.disableDefaultMetrics = b
+	}
+}
+
+// WithUserQueriesPath configures user's queries path.
+func WithUserQueriesPath(p string) ExporterOpt {
+	return func(e *Exporter) {
+		e.userQueriesPath = p
+	}
+}
+
+// WithUserQueriesPriority configures how user queries for a namespace which
+// is already defined are merged, one of the userQueries* constants.
+func WithUserQueriesPriority(p string) ExporterOpt {
+	return func(e *Exporter) {
+		e.userQueriesPriority = p
+	}
+}
+
+// WithSearchPath configures the search_path namespace queries are run with,
+// unless the namespace sets its own.
+func WithSearchPath(p string) ExporterOpt {
+	return func(e *Exporter) {
+		e.searchPath = p
+	}
+}
+
+// WithCollectors enables the named optional collectors.
+func WithCollectors(names []string) ExporterOpt {
+	return func(e *Exporter) {
+		e.collectors = names
+	}
+}
+
+// WithCompat adapts the builtin queries to the named PostgreSQL compatible
+// service.
+func WithCompat(name string) ExporterOpt {
+	return func(e *Exporter) {
+		e.compat = name
+	}
+}
+
+// WithTablespacePaths configures the paths whose filesystem free space is
+// reported per tablespace.
+func WithTablespacePaths(paths map[string]string) ExporterOpt {
+	return func(e *Exporter) {
+		e.tablespacePaths = paths
+	}
+}
+
+// WithConnectTimeout bounds how long checking the database connection at the
+// start of a scrape may take.
+func WithConnectTimeout(d time.Duration) ExporterOpt {
+	return func(e *Exporter) {
+		e.connectTimeout = d
+	}
+}
+
+// WithQueryTimeout bounds how long the query of each namespace may run.
+func WithQueryTimeout(d time.Duration) ExporterOpt {
+	return func(e *Exporter) {
+		e.queryTimeout = d
+	}
+}
+
+// WithMaxConnectionAge makes the database connections reopen once they are
+// older than d, 0 keeps them open until they fail.
+func WithMaxConnectionAge(d time.Duration) ExporterOpt {
+	return func(e *Exporter) {
+		e.maxConnectionAge = d
+	}
+}
+
+// WithMaxOpenConns limits the number of open connections to the database.
+func WithMaxOpenConns(n int) ExporterOpt {
+	return func(e *Exporter) {
+		e.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns limits the number of idle connections kept open to the
+// database.
+func WithMaxIdleConns(n int) ExporterOpt {
+	return func(e *Exporter) {
+		e.maxIdleConns = n
+	}
+}
+
+// WithSetRole configures the role each new database connection switches to.
+func WithSetRole(role string) ExporterOpt {
+	return func(e *Exporter) {
+		e.setRole = role
+	}
+}
+
+// WithMaintenanceFile puts the exporter in maintenance mode while the file at
+// path exists. If suppressErrors is set pg_up and the scrape error keep the
+// values they had before.
+func WithMaintenanceFile(path string, suppressErrors bool) ExporterOpt {
+	return func(e *Exporter) {
+		e.maintenanceFile = path
+		e.maintenanceSuppressErrors = suppressErrors
+	}
+}
+
+// WithDebugMetrics configures whether the metrics for debugging queries are
+// reported.
+func WithDebugMetrics(b bool) ExporterOpt {
+	return func(e *Exporter) {
+		e.debugMetrics = b
+	}
+}
+
+// WithExitOnDBUnreachable makes a scrape exit the process if it cannot
+// connect to the database and no scrape could for d.
+func WithExitOnDBUnreachable(d time.Duration) ExporterOpt {
+	return func(e *Exporter) {
+		e.exitOnDBUnreachable = d
+	}
+}
+
+// WithQueryFilters limits the rows of the namespaces in filters to those
+// matching their condition.
+func WithQueryFilters(filters map[string]string) ExporterOpt {
+	return func(e *Exporter) {
+		e.queryFilters = filters
+	}
+}
+
+// WithQueryOverrides replaces the queries of the namespaces in overrides, for
+// every server version.
+func WithQueryOverrides(overrides map[string]string) ExporterOpt {
+	return func(e *Exporter) {
+		e.extraQueryOverrides = overrides
+	}
+}
+
+// WithQueryLimits limits the number of rows of the namespaces in limits.
+func WithQueryLimits(limits map[string]int64) ExporterOpt {
+	return func(e *Exporter) {
+		e.queryLimits = limits
+	}
+}
+
+// WithNamespaceRenames renames the metrics of the builtin and collector
+// namespaces in renames to their new prefix.
+func WithNamespaceRenames(renames map[string]string) ExporterOpt {
+	return func(e *Exporter) {
+		e.descMapOptions.renames = renames
+	}
+}
+
+// WithForcedUsages overrides the usage of the builtin and collector columns
+// in usages, keyed by namespace.column.
+func WithForcedUsages(usages map[string]ColumnUsage) ExporterOpt {
+	return func(e *Exporter) {
+		e.descMapOptions.usages = usages
+	}
+}
+
+// WithDropColumns discards the columns of each namespace in columns, whether
+// builtin, collector or custom query columns.
+func WithDropColumns(columns map[string][]string) ExporterOpt {
+	return func(e *Exporter) {
+		e.dropColumns = columns
+	}
+}
+
+// WithReplicaDSN configures the replica the namespaces preferring it are
+// queried on.
+func WithReplicaDSN(dsn string) ExporterOpt {
+	return func(e *Exporter) {
+		e.replicaDSN = dsn
+	}
+}
+
+// WithReplicaNamespaces configures the builtin and collector namespaces which
+// are queried on the replica, like the custom queries preferring it.
+func WithReplicaNamespaces(namespaces map[string]bool) ExporterOpt {
+	return func(e *Exporter) {
+		e.replicaNamespaces = namespaces
+	}
+}
+
+// WithNullLabelValue configures the label value used for NULL label columns.
+func WithNullLabelValue(v string) ExporterOpt {
+	return func(e *Exporter) {
+		e.nullLabelValue = v
+	}
 }
 
 // NewExporter returns a new PostgreSQL exporter for the provided DSN.
-func NewExporter(dsn string, disableDefaultMetrics bool, userQueriesPath string) *Exporter {
-	return &Exporter{
-		builtinMetricMaps:     builtinMetricMaps,
-		dsn:                   dsn,
-		disableDefaultMetrics: disableDefaultMetrics,
-		userQueriesPath:       userQueriesPath,
+func NewExporter(dsn string, opts ...ExporterOpt) *Exporter {
+	e := &Exporter{
+		builtinMetricMaps: builtinMetricMaps,
+		dsn:               dsn,
+		lastConnected:     time.Now(),
+		maxOpenConns:      1,
+		maxIdleConns:      1,
+		counterResets:     newCounterResets(),
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: exporter,
@@ -755,50 +1777,133 @@ func NewExporter(dsn string, disableDefaultMetrics bool, userQueriesPath string)
 			Name:      "user_queries_load_error",
 			Help:      "Whether the user queries file was loaded and parsed successfully (1 for error, 0 for success).",
 		}, []string{"filename", "hashsum"}),
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "last_reload_successful",
+			Help:      "Whether the last reload on SIGHUP succeeded (1 for success, 0 for error).",
+		}),
+		lastReloadSuccessTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful reload on SIGHUP, or of the exporter start.",
+		}),
+		maintenanceMode: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "maintenance_mode",
+			Help:      "Whether the exporter is in maintenance mode, while the maintenance file exists (1 for yes, 0 for no).",
+		}),
 		metricMap:      nil,
 		queryOverrides: nil,
 	}
-}
 
-// Describe implements prometheus.Collector.
-func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	// We cannot know in advance what metrics the exporter will generate
-	// from Postgres. So we use the poor man's describe method: Run a collect
-	// and send the descriptors of all the collected metrics. The problem
-	// here is that we need to connect to the Postgres DB. If it is currently
-	// unavailable, the descriptors will be incomplete. Since this is a
-	// stand-alone exporter and not used as a library within other code
-	// implementing additional metrics, the worst that can happen is that we
-	// don't detect inconsistent metrics created by this exporter
-	// itself. Also, a change in the monitored Postgres instance may change the
-	// exported metrics during the runtime of the exporter.
+	for _, opt := range opts {
+		opt(e)
+	}
 
-	metricCh := make(chan prometheus.Metric)
-	doneCh := make(chan struct{})
+	e.lastReloadSuccessful.Set(1)
+	e.lastReloadSuccessTimestamp.SetToCurrentTime()
 
-	go func() {
-		for m := range metricCh {
-			ch <- m.Desc()
-		}
-		close(doneCh)
-	}()
+	return e
+}
+
+// closeConnections closes the connections to the database and its replica.
+func (e *Exporter) closeConnections() {
+	e.connMtx.Lock()
+	if e.dbConnection != nil {
+		e.dbConnection.Close() // nolint: errcheck
+	}
+	e.connMtx.Unlock()
+	e.replicaMtx.Lock()
+	if e.replicaConnection != nil {
+		e.replicaConnection.Close() // nolint: errcheck
+	}
+	e.replicaMtx.Unlock()
+}
 
-	e.Collect(metricCh)
-	close(metricCh)
-	<-doneCh
+// Describe implements prometheus.Collector. It only sends the descriptors of
+// the exporter's own metrics: the metrics of the database depend on its
+// version, the custom queries and the collectors, and are only known once
+// scraped. The registry does not require collected metrics to be described,
+// so registering the exporter does not run a scrape, whose errors nobody
+// would see.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.duration.Desc()
+	ch <- e.totalScrapes.Desc()
+	ch <- e.error.Desc()
+	ch <- e.psqlUp.Desc()
+	e.userQueriesError.Describe(ch)
+	ch <- e.lastReloadSuccessful.Desc()
+	ch <- e.lastReloadSuccessTimestamp.Desc()
+	ch <- e.maintenanceMode.Desc()
+	ch <- userQuerySuccessDesc
+	ch <- namespaceScrapeDurationDesc
+	ch <- namespaceScrapeErrorDesc
+	ch <- namespaceRowsScannedDesc
 }
 
 // Collect implements prometheus.Collector.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	e.scrape(ch)
+	maintenance := e.inMaintenance()
+	if maintenance {
+		e.maintenanceMode.Set(1)
+	} else {
+		e.maintenanceMode.Set(0)
+	}
+
+	if e.maintenanceSuppressErrors {
+		// Scrapes are serialized so one cannot save the values another is
+		// about to restore, or overwrite them once restored
+		e.suppressMtx.Lock()
+		if maintenance {
+			up, failed := gaugeValue(e.psqlUp), gaugeValue(e.error)
+			e.scrape(ch)
+			e.psqlUp.Set(up)
+			e.error.Set(failed)
+		} else {
+			e.scrape(ch)
+		}
+		e.suppressMtx.Unlock()
+	} else {
+		e.scrape(ch)
+	}
 
 	ch <- e.duration
 	ch <- e.totalScrapes
 	ch <- e.error
 	ch <- e.psqlUp
 	e.userQueriesError.Collect(ch)
+	ch <- e.lastReloadSuccessful
+	ch <- e.lastReloadSuccessTimestamp
+	ch <- e.maintenanceMode
 }
 
+var userQuerySuccessDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "user_query_success"),
+	"Whether the custom query of this namespace ran without error in the last scrape (1 for success, 0 for error).",
+	[]string{"namespace"}, nil,
+)
+
+var namespaceScrapeDurationDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "namespace_scrape_duration_seconds"),
+	"Duration of the query of this namespace in the last scrape.",
+	[]string{"namespace"}, nil,
+)
+
+var namespaceScrapeErrorDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "namespace_scrape_error"),
+	"Whether the query of this namespace failed in the last scrape, entirely or for some rows (1 for error, 0 for success).",
+	[]string{"namespace"}, nil,
+)
+
+var namespaceRowsScannedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "namespace_rows_scanned"),
+	"Number of rows the query of this namespace returned in the last scrape.",
+	[]string{"namespace"}, nil,
+)
+
 func newDesc(subsystem, name, help string) *prometheus.Desc {
 	return prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, name),
@@ -806,39 +1911,149 @@ func newDesc(subsystem, name, help string) *prometheus.Desc {
 	)
 }
 
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryTimeoutError is the non-fatal error of a namespace query canceled by
+// the query timeout.
+type queryTimeoutError struct {
+	namespace string
+	timeout   time.Duration
+}
+
+func (err *queryTimeoutError) Error() string {
+	return fmt.Sprintf("Query of %s canceled after the query timeout of %s", err.namespace, err.timeout)
+}
+
+// schemaLabel is the label added to namespaces run with for_each_schema.
+const schemaLabel = "schema"
+
 // Query within a namespace mapping and emit metrics. Returns fatal errors if
 // the scrape fails, and a slice of errors if they were non-fatal.
-func queryNamespaceMapping(ch chan<- prometheus.Metric, db *sql.DB, namespace string, mapping MetricMapNamespace, queryOverrides map[string]string) ([]error, error) {
+func (e *Exporter) queryNamespaceMapping(ctx context.Context, ch chan<- prometheus.Metric, db *sql.DB, namespace string, mapping MetricMapNamespace) (int, []error, error) {
 	// Check for a query override for this namespace
-	query, found := queryOverrides[namespace]
+	query, found := e.queryOverrides[namespace]
 
 	// Was this query disabled (i.e. nothing sensible can be queried on cu
 	// version of PostgreSQL?
 	if query == "" && found {
 		// Return success (no pertinent data)
-		return []error{}, nil
+		return 0, []error{}, nil
+	}
+
+	if !found {
+		query = defaultNamespaceQuery(namespace)
+	}
+
+	if mapping.forEachSchema == "" {
+		searchPath := e.searchPath
+		if mapping.searchPath != "" {
+			searchPath = mapping.searchPath
+		}
+		return e.queryNamespace(ctx, ch, db, namespace, mapping, query, searchPath, "")
+	}
+
+	schemas, err := querySchemas(ctx, db, mapping.forEachSchema)
+	if err != nil {
+		return 0, []error{}, errors.New(fmt.Sprintln("Error discovering schemas for: ", namespace, err))
 	}
 
+	// A failure in one schema should not stop the others from being scraped
+	scanned := 0
+	nonfatalErrors := []error{}
+	for _, schema := range schemas {
+		rows, errs, err := e.queryNamespace(ctx, ch, db, namespace, mapping, query, quoteIdentifier(schema), schema)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintln("Error in schema", schema, "-", err)))
+		}
+		scanned += rows
+		nonfatalErrors = append(nonfatalErrors, errs...)
+	}
+	return scanned, nonfatalErrors, nil
+}
+
+// isLockTimeout returns whether err is PostgreSQL canceling a statement which
+// waited longer than lock_timeout.
+func isLockTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "55P03"
+}
+
+// lockTimeoutError is the non-fatal error of a namespace query canceled by
+// lock_timeout.
+func lockTimeoutError(namespace string, err error) error {
+	return errors.New(fmt.Sprintln("Timed out waiting for a lock running query on database: ", namespace, err))
+}
+
+// querySchemas returns the names of the schemas matching the regular
+// expression pattern.
+func querySchemas(ctx context.Context, db *sql.DB, pattern string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT schema_name FROM information_schema.schemata WHERE schema_name ~ $1 ORDER BY schema_name", pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
+
+// queryNamespace runs the query of a namespace with the given search_path, if
+// any, and emits its metrics. If schema is set it is used as the value of the
+// schema label. Queries running past the query timeout are canceled and
+// reported as a non-fatal error. It returns the number of rows scanned.
+func (e *Exporter) queryNamespace(ctx context.Context, ch chan<- prometheus.Metric, db *sql.DB, namespace string, mapping MetricMapNamespace, query, searchPath, schema string) (int, []error, error) {
 	// Don't fail on a bad scrape of one metric
 	var rows *sql.Rows
 	var err error
+	var q queryer = db
 
-	if !found {
-		// I've no idea how to avoid this properly at the moment, but this is
-		// an admin tool so you're not injecting SQL right?
-		rows, err = db.Query(fmt.Sprintf("SELECT * FROM %s;", namespace)) // nolint: gas, safesql
-	} else {
-		rows, err = db.Query(query) // nolint: safesql
+	if e.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.queryTimeout)
+		defer cancel()
+	}
+
+	if searchPath != "" {
+		// Run the query in a transaction so the search_path only applies to it
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, []error{}, errors.New(fmt.Sprintln("Error starting transaction for: ", namespace, err))
+		}
+		defer tx.Rollback() // nolint: errcheck
+
+		if _, err := tx.ExecContext(ctx, "SELECT set_config('search_path', $1, true)", searchPath); err != nil {
+			return 0, []error{}, errors.New(fmt.Sprintln("Error setting search_path for: ", namespace, err))
+		}
+		q = tx
+	}
+
+	rows, err = q.QueryContext(ctx, query) // nolint: gas, safesql
+	if isLockTimeout(err) {
+		// Blocked behind DDL, the next scrape will likely succeed
+		return 0, []error{lockTimeoutError(namespace, err)}, nil
 	}
 	if err != nil {
-		return []error{}, errors.New(fmt.Sprintln("Error running query on database: ", namespace, err))
+		if ctx.Err() == context.DeadlineExceeded {
+			return 0, []error{&queryTimeoutError{namespace: namespace, timeout: e.queryTimeout}}, nil
+		}
+		return 0, []error{}, errors.New(fmt.Sprintln("Error running query on database: ", namespace, err))
 	}
 	defer rows.Close() // nolint: errcheck
 
 	var columnNames []string
 	columnNames, err = rows.Columns()
 	if err != nil {
-		return []error{}, errors.New(fmt.Sprintln("Error retrieving column list for: ", namespace, err))
+		return 0, []error{}, errors.New(fmt.Sprintln("Error retrieving column list for: ", namespace, err))
 	}
 
 	// Make a lookup map for the column indices
@@ -855,16 +2070,33 @@ func queryNamespaceMapping(ch chan<- prometheus.Metric, db *sql.DB, namespace st
 
 	nonfatalErrors := []error{}
 
+	// Unknown columns are named like the known ones
+	prefix := mapping.prefix
+	if prefix == "" {
+		prefix = namespace
+	}
+
+	scanned := 0
 	for rows.Next() {
+		scanned++
 		err = rows.Scan(scanArgs...)
 		if err != nil {
-			return []error{}, errors.New(fmt.Sprintln("Error retrieving rows:", namespace, err))
+			return scanned, []error{}, errors.New(fmt.Sprintln("Error retrieving rows:", namespace, err))
 		}
 
 		// Get the label values for this row
 		var labels = make([]string, len(mapping.labels))
 		for idx, columnName := range mapping.labels {
-			labels[idx], _ = dbToString(columnData[columnIdx[columnName]])
+			if schema != "" && columnName == schemaLabel {
+				labels[idx] = schema
+				continue
+			}
+			value := columnData[columnIdx[columnName]]
+			if value == nil {
+				labels[idx] = e.nullLabelValue
+				continue
+			}
+			labels[idx], _ = dbToString(value)
 		}
 
 		// Loop over column names, and match to scan data. Unknown columns
@@ -877,17 +2109,34 @@ func queryNamespaceMapping(ch chan<- prometheus.Metric, db *sql.DB, namespace st
 					continue
 				}
 
-				value, ok := dbToFloat64(columnData[idx])
+				value, ok := metricMapping.conversion(columnData[idx])
 				if !ok {
 					nonfatalErrors = append(nonfatalErrors, errors.New(fmt.Sprintln("Unexpected error parsing column: ", namespace, columnName, columnData[idx])))
 					continue
 				}
 
+				if metricMapping.average != "" {
+					count := math.NaN()
+					if i, ok := columnIdx[metricMapping.average]; ok {
+						count, _ = dbToFloat64(columnData[i])
+					}
+					value = e.counterResets.average(namespace, metricMapping.desc.String(), labels, value, count)
+				}
+
 				// Generate the metric
 				ch <- prometheus.MustNewConstMetric(metricMapping.desc, metricMapping.vtype, value, labels...)
+
+				if metricMapping.resets != nil {
+					observe := e.counterResets.observe
+					if metricMapping.onChange {
+						observe = e.counterResets.observeChange
+					}
+					resets := observe(namespace, metricMapping.desc.String(), labels, value)
+					ch <- prometheus.MustNewConstMetric(metricMapping.resets, prometheus.CounterValue, resets, labels...)
+				}
 			} else {
 				// Unknown metric. Report as untyped if scan to float64 works, else note an error too.
-				metricLabel := fmt.Sprintf("%s_%s", namespace, columnName)
+				metricLabel := fmt.Sprintf("%s_%s", prefix, columnName)
 				desc := prometheus.NewDesc(metricLabel, fmt.Sprintf("Unknown metric from %s", namespace), mapping.labels, nil)
 
 				// Its not an error to fail here, since the values are
@@ -900,28 +2149,236 @@ func queryNamespaceMapping(ch chan<- prometheus.Metric, db *sql.DB, namespace st
 				ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, value, labels...)
 			}
 		}
+
+		for name, summary := range mapping.summaries {
+			metric, err := summary.metric(mapping.columnMappings[name].desc, columnIdx, columnData, labels)
+			if err != nil {
+				nonfatalErrors = append(nonfatalErrors, errors.New(fmt.Sprintln("Error building summary: ", namespace, name, err)))
+				continue
+			}
+			ch <- metric
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// The lock timeout and the deadline can also strike while the rows
+		// are being read
+		if isLockTimeout(err) {
+			return scanned, append(nonfatalErrors, lockTimeoutError(namespace, err)), nil
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return scanned, append(nonfatalErrors, &queryTimeoutError{namespace: namespace, timeout: e.queryTimeout}), nil
+		}
+		return scanned, nonfatalErrors, errors.New(fmt.Sprintln("Error retrieving rows:", namespace, err))
+	}
+
+	if scanned == 0 && mapping.emitZeroOnEmpty {
+		for _, metricMapping := range mapping.columnMappings {
+			if !metricMapping.discard {
+				ch <- prometheus.MustNewConstMetric(metricMapping.desc, metricMapping.vtype, 0)
+			}
+		}
+	}
+	return scanned, nonfatalErrors, nil
+}
+
+// parseSummaryQuantiles parses the quantile to column mapping of a SUMMARY
+// column.
+func parseSummaryQuantiles(v interface{}) (map[float64]string, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("quantiles must map quantiles to column names")
+	}
+
+	quantiles := make(map[float64]string, len(m))
+	for k, column := range m {
+		q, err := strconv.ParseFloat(fmt.Sprint(k), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("invalid quantile %v", k)
+		}
+		quantiles[q] = fmt.Sprint(column)
+	}
+	return quantiles, nil
+}
+
+// parseBool parses the boolean option key of a custom query.
+func parseBool(key string, v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return b, nil
+}
+
+// parseStaticLabels parses the label name to value mapping of a column. The
+// values are literal strings, not column references.
+func parseStaticLabels(v interface{}) (prometheus.Labels, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("labels must map label names to values")
+	}
+
+	labels := make(prometheus.Labels, len(m))
+	for k, value := range m {
+		name := fmt.Sprint(k)
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		labels[name] = fmt.Sprint(value)
+	}
+	return labels, nil
+}
+
+// parseHistogramBuckets parses the bucket upper bound to column mapping of a
+// HISTOGRAM column.
+func parseHistogramBuckets(v interface{}) (map[float64]string, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("buckets must map bucket upper bounds to column names")
+	}
+
+	buckets := make(map[float64]string, len(m))
+	for k, column := range m {
+		le, err := strconv.ParseFloat(fmt.Sprint(k), 64)
+		if err != nil || math.IsNaN(le) {
+			return nil, fmt.Errorf("invalid bucket upper bound %v", k)
+		}
+		buckets[le] = fmt.Sprint(column)
+	}
+	return buckets, nil
+}
+
+// parseMetricMapping parses the text to value mapping of a MAPPEDMETRIC
+// column.
+func parseMetricMapping(v interface{}) (map[string]float64, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("metric_mapping must map text values to numbers")
+	}
+
+	mapping := make(map[string]float64, len(m))
+	for text, value := range m {
+		f, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric_mapping value %v for %q", value, fmt.Sprint(text))
+		}
+		mapping[fmt.Sprint(text)] = f
+	}
+	return mapping, nil
+}
+
+// columns returns the names of the columns the summary is built from.
+func (s summaryColumns) columns() []string {
+	columns := []string{s.sum, s.count}
+	for _, column := range s.quantiles {
+		columns = append(columns, column)
+	}
+	for _, column := range s.buckets {
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// metric builds the summary, or the histogram, from a row of query results.
+func (s summaryColumns) metric(desc *prometheus.Desc, columnIdx map[string]int, columnData []interface{}, labels []string) (prometheus.Metric, error) {
+	value := func(column string) (float64, error) {
+		idx, ok := columnIdx[column]
+		if !ok {
+			return 0, fmt.Errorf("missing column %q", column)
+		}
+		v, ok := dbToFloat64(columnData[idx])
+		if !ok {
+			return 0, fmt.Errorf("unparseable column %q: %v", column, columnData[idx])
+		}
+		return v, nil
+	}
+
+	count, err := value(s.count)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(count) || count < 0 {
+		return nil, fmt.Errorf("invalid count in column %q: %v", s.count, count)
+	}
+	sum, err := value(s.sum)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.histogram {
+		buckets := make(map[float64]uint64, len(s.buckets))
+		for le, column := range s.buckets {
+			v, err := value(column)
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(v) || v < 0 {
+				return nil, fmt.Errorf("invalid bucket count in column %q: %v", column, v)
+			}
+			buckets[le] = uint64(v)
+		}
+		return prometheus.NewConstHistogram(desc, uint64(count), sum, buckets, labels...)
+	}
+
+	quantiles := make(map[float64]float64, len(s.quantiles))
+	for q, column := range s.quantiles {
+		if quantiles[q], err = value(column); err != nil {
+			return nil, err
+		}
 	}
-	return nonfatalErrors, nil
+
+	return prometheus.NewConstSummary(desc, uint64(count), sum, quantiles, labels...)
 }
 
 // Iterate through all the namespace mappings in the exporter and run their
 // queries.
-func queryNamespaceMappings(ch chan<- prometheus.Metric, db *sql.DB, metricMap map[string]MetricMapNamespace, queryOverrides map[string]string) map[string]error {
+// Namespaces preferring the replica are queried on replica, unless it is nil.
+// Only the namespaces carrying tag are queried, unless it is empty.
+func (e *Exporter) queryNamespaceMappings(ctx context.Context, ch chan<- prometheus.Metric, db, replica *sql.DB, tag string) map[string]error {
 	// Return a map of namespace -> errors
 	namespaceErrors := make(map[string]error)
 
-	for namespace, mapping := range metricMap {
+	for namespace, mapping := range e.metricMap {
+		if tag != "" && !mapping.hasTag(tag) {
+			continue
+		}
 		log.Debugln("Querying namespace: ", namespace)
-		nonFatalErrors, err := queryNamespaceMapping(ch, db, namespace, mapping, queryOverrides)
+		namespaceDB := db
+		if mapping.preferReplica && replica != nil {
+			log.Debugln("Querying namespace on the replica: ", namespace)
+			namespaceDB = replica
+		}
+		begun := time.Now()
+		scanned, nonFatalErrors, err := e.queryNamespaceMapping(ctx, ch, namespaceDB, namespace, mapping)
+		ch <- prometheus.MustNewConstMetric(namespaceScrapeDurationDesc, prometheus.GaugeValue, time.Since(begun).Seconds(), namespace)
+		if e.debugMetrics {
+			ch <- prometheus.MustNewConstMetric(namespaceRowsScannedDesc, prometheus.GaugeValue, float64(scanned), namespace)
+		}
+		failed := 0.0
+		if err != nil || len(nonFatalErrors) > 0 {
+			failed = 1
+			e.counterResets.fail(namespace)
+		}
+		ch <- prometheus.MustNewConstMetric(namespaceScrapeErrorDesc, prometheus.GaugeValue, failed, namespace)
 		// Serious error - a namespace disappeared
 		if err != nil {
 			namespaceErrors[namespace] = err
 			log.Infoln(err)
 		}
+		if mapping.userQuery {
+			success := 1.0
+			if err != nil || len(nonFatalErrors) > 0 {
+				success = 0
+			}
+			ch <- prometheus.MustNewConstMetric(userQuerySuccessDesc, prometheus.GaugeValue, success, namespace)
+		}
 		// Non-serious errors - likely version or parsing problems.
 		if len(nonFatalErrors) > 0 {
 			for _, err := range nonFatalErrors {
 				log.Infoln(err.Error())
+				// A timed out query leaves the namespace without metrics
+				if _, ok := err.(*queryTimeoutError); ok {
+					e.error.Set(1)
+				}
 			}
 		}
 	}
@@ -950,56 +2407,220 @@ func (e *Exporter) checkMapVersions(ch chan<- prometheus.Metric, db *sql.DB) err
 	if semanticVersion.NE(e.lastMapVersion) || e.metricMap == nil {
 		log.Infoln("Semantic Version Changed:", e.lastMapVersion.String(), "->", semanticVersion.String())
 		e.mappingMtx.Lock()
+		e.loadMaps(semanticVersion) // nolint: errcheck
+		e.mappingMtx.Unlock()
+	}
 
-		if e.disableDefaultMetrics {
-			e.metricMap = make(map[string]MetricMapNamespace)
-		} else {
-			e.metricMap = makeDescMap(semanticVersion, e.builtinMetricMaps)
-		}
+	// Output the version as a special metric
+	versionDesc := prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, staticLabelName),
+		"Version string as reported by postgres", []string{"version", "short_version"}, nil)
 
-		if e.disableDefaultMetrics {
-			e.queryOverrides = make(map[string]string)
-		} else {
-			e.queryOverrides = makeQueryOverrideMap(semanticVersion, queryOverrides)
-		}
+	ch <- prometheus.MustNewConstMetric(versionDesc,
+		prometheus.UntypedValue, 1, versionString, semanticVersion.String())
+	ch <- prometheus.MustNewConstMetric(serverVersionNumDesc,
+		prometheus.GaugeValue, serverVersionNum(semanticVersion))
+	return nil
+}
 
-		e.lastMapVersion = semanticVersion
+var serverVersionNumDesc = prometheus.NewDesc(fmt.Sprintf("%s_server_version_num", namespace),
+	"Version of the server as a number, like the server_version_num setting, e.g. 90605 for 9.6.5 or 130004 for 13.4", nil, nil)
 
-		if e.userQueriesPath != "" {
-			// Clear the metric while a reload is happening
-			e.userQueriesError.Reset()
+// serverVersionNum returns version as PostgreSQL numbers it in
+// server_version_num, which has no patch level since 10.
+func serverVersionNum(version semver.Version) float64 {
+	if version.Major >= 10 {
+		return float64(version.Major*10000 + version.Minor)
+	}
+	return float64(version.Major*10000 + version.Minor*100 + version.Patch)
+}
 
-			// Calculate the hashsum of the useQueries
-			userQueriesData, err := ioutil.ReadFile(e.userQueriesPath)
-			if err != nil {
-				log.Errorln("Failed to reload user queries:", e.userQueriesPath, err)
-				e.userQueriesError.WithLabelValues(e.userQueriesPath, "").Set(1)
-			} else {
-				hashsumStr := fmt.Sprintf("%x", sha256.Sum256(userQueriesData))
-
-				if err := addQueries(userQueriesData, semanticVersion, e.metricMap, e.queryOverrides); err != nil {
-					log.Errorln("Failed to reload user queries:", e.userQueriesPath, err)
-					e.userQueriesError.WithLabelValues(e.userQueriesPath, hashsumStr).Set(1)
-				} else {
-					// Mark user queries as successfully loaded
-					e.userQueriesError.WithLabelValues(e.userQueriesPath, hashsumStr).Set(0)
-				}
+// loadMaps builds the metric maps and query overrides for the given server
+// version, including the user queries. If the user queries cannot be loaded
+// the maps are built without them, and the error is returned. The caller must
+// hold mappingMtx.
+func (e *Exporter) loadMaps(semanticVersion semver.Version) error {
+	// Deferred so the columns of the user queries are dropped too
+	defer func() { discardColumns(e.metricMap, e.dropColumns) }()
+	// Deferred so an override of a namespace by the user queries keeps
+	// preferring the replica
+	defer func() { preferReplica(e.metricMap, e.replicaNamespaces) }()
+
+	if e.disableDefaultMetrics {
+		e.metricMap = make(map[string]MetricMapNamespace)
+	} else {
+		e.metricMap = makeDescMap(semanticVersion, e.builtinMetricMaps, e.descMapOptions)
+	}
+
+	if e.disableDefaultMetrics {
+		e.queryOverrides = make(map[string]string)
+	} else {
+		e.queryOverrides = makeQueryOverrideMap(semanticVersion, queryOverrides)
+
+		if mode, ok := compatModes[e.compat]; ok {
+			for k, v := range makeDescMap(semanticVersion, mode.metricMaps, e.descMapOptions) {
+				e.metricMap[k] = v
+			}
+			for k, v := range makeQueryOverrideMap(semanticVersion, mode.queryOverrides) {
+				e.queryOverrides[k] = v
 			}
 		}
+	}
 
-		e.mappingMtx.Unlock()
+	// Optional collectors were explicitly enabled, so they are added
+	// even if default metrics are disabled.
+	for _, name := range e.collectors {
+		collector := optionalCollectors[name]
+		opts := e.descMapOptions
+		opts.names = collector.metricNames
+		opts.averages = collector.averages
+		for k, v := range makeDescMap(semanticVersion, collector.metricMaps, opts) {
+			e.metricMap[k] = v
+		}
+		for k, v := range makeQueryOverrideMap(semanticVersion, collector.queryOverrides) {
+			e.queryOverrides[k] = v
+		}
 	}
 
-	// Output the version as a special metric
-	versionDesc := prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, staticLabelName),
-		"Version string as reported by postgres", []string{"version", "short_version"}, nil)
+	for namespace, query := range e.extraQueryOverrides {
+		if _, ok := e.queryOverrides[namespace]; ok {
+			e.queryOverrides[namespace] = query
+		}
+	}
 
-	ch <- prometheus.MustNewConstMetric(versionDesc,
-		prometheus.UntypedValue, 1, versionString, semanticVersion.String())
+	for namespace, condition := range e.queryFilters {
+		if query := e.queryOverrides[namespace]; query != "" {
+			e.queryOverrides[namespace] = fmt.Sprintf("SELECT * FROM (%s) AS filtered WHERE %s", query, condition)
+		}
+	}
+	for namespace, limit := range e.queryLimits {
+		if query := e.queryOverrides[namespace]; query != "" {
+			e.queryOverrides[namespace] = fmt.Sprintf("SELECT * FROM (%s) AS limited LIMIT %d", query, limit)
+		}
+	}
+
+	e.lastMapVersion = semanticVersion
+
+	if e.userQueriesPath == "" {
+		return nil
+	}
+
+	// Clear the metric while a reload is happening
+	e.userQueriesError.Reset()
+
+	// Calculate the hashsum of the useQueries
+	userQueriesData, err := ioutil.ReadFile(e.userQueriesPath)
+	if err != nil {
+		log.Errorln("Failed to reload user queries:", e.userQueriesPath, err)
+		e.userQueriesError.WithLabelValues(e.userQueriesPath, "").Set(1)
+		return err
+	}
+	hashsumStr := fmt.Sprintf("%x", sha256.Sum256(userQueriesData))
+
+	if err := addQueries(userQueriesData, semanticVersion, e.metricMap, e.queryOverrides, e.userQueriesPriority); err != nil {
+		log.Errorln("Failed to reload user queries:", e.userQueriesPath, err)
+		e.userQueriesError.WithLabelValues(e.userQueriesPath, hashsumStr).Set(1)
+		return err
+	}
+
+	// Mark user queries as successfully loaded
+	e.userQueriesError.WithLabelValues(e.userQueriesPath, hashsumStr).Set(0)
+	return nil
+}
+
+// Reload reloads the user queries, rebuilding the metric maps for the server
+// version of the last scrape, and records the outcome in the reload metrics.
+// If the user queries cannot be loaded the previous maps are kept. Before the
+// first scrape there is nothing to rebuild; the first scrape loads the user
+// queries anyway.
+func (e *Exporter) Reload() error {
+	var err error
+	e.mappingMtx.Lock()
+	if e.metricMap != nil {
+		metricMap, queryOverrides := e.metricMap, e.queryOverrides
+		if err = e.loadMaps(e.lastMapVersion); err != nil {
+			e.metricMap, e.queryOverrides = metricMap, queryOverrides
+		}
+	}
+	e.mappingMtx.Unlock()
+
+	if err != nil {
+		e.lastReloadSuccessful.Set(0)
+		return err
+	}
+	e.lastReloadSuccessful.Set(1)
+	e.lastReloadSuccessTimestamp.SetToCurrentTime()
 	return nil
 }
 
+// reloadOnSIGHUP reloads the exporter on every SIGHUP received.
+func (e *Exporter) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := e.Reload(); err != nil {
+			log.Errorln("Failed to reload:", err)
+			continue
+		}
+		log.Infoln("Reloaded user queries", e.userQueriesPath)
+	}
+}
+
+// replicaPingInterval is how often the connection to the replica is checked.
+// In between, a failing replica fails the queries preferring it instead of
+// falling back to the primary.
+const replicaPingInterval = time.Minute
+
+// getReplicaDB returns the connection to the replica, or nil if none is
+// configured or it cannot be reached, in which case the primary is used.
+func (e *Exporter) getReplicaDB() *sql.DB {
+	if e.replicaDSN == "" {
+		return nil
+	}
+
+	e.replicaMtx.Lock()
+	defer e.replicaMtx.Unlock()
+
+	if e.replicaConnection == nil {
+		d, err := openDB(e.replicaDSN, e.setRole)
+		if err != nil {
+			log.Infoln("Error opening connection to replica database, using the primary:", err)
+			return nil
+		}
+
+		d.SetMaxOpenConns(e.maxOpenConns)
+		d.SetMaxIdleConns(e.maxIdleConns)
+		d.SetConnMaxLifetime(e.maxConnectionAge)
+		e.replicaConnection = d
+		e.replicaPinged = time.Time{}
+		log.Infoln("Established new replica database connection.")
+	}
+
+	if time.Since(e.replicaPinged) < replicaPingInterval {
+		return e.replicaConnection
+	}
+
+	ctx := context.Background()
+	if e.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.connectTimeout)
+		defer cancel()
+	}
+
+	if err := e.replicaConnection.PingContext(ctx); err != nil {
+		log.Infoln("Error pinging replica database, using the primary:", err)
+		e.replicaConnection.Close() // nolint: errcheck
+		e.replicaConnection = nil
+		return nil
+	}
+	e.replicaPinged = time.Now()
+
+	return e.replicaConnection
+}
+
 func (e *Exporter) getDB(conn string) (*sql.DB, error) {
+	e.connMtx.Lock()
+	defer e.connMtx.Unlock()
+
 	// Has dsn changed?
 	if (e.dbConnection != nil) && (e.dsn != e.dbDsn) {
 		err := e.dbConnection.Close()
@@ -1009,26 +2630,36 @@ func (e *Exporter) getDB(conn string) (*sql.DB, error) {
 	}
 
 	if e.dbConnection == nil {
-		d, err := sql.Open("postgres", conn)
+		d, err := openDB(conn, e.setRole)
 		if err != nil {
 			return nil, err
 		}
 
-		d.SetMaxOpenConns(1)
-		d.SetMaxIdleConns(1)
+		d.SetMaxOpenConns(e.maxOpenConns)
+		d.SetMaxIdleConns(e.maxIdleConns)
+		// Connections past the age are closed, and redialed by name
+		d.SetConnMaxLifetime(e.maxConnectionAge)
 		e.dbConnection = d
 		e.dbDsn = e.dsn
 		log.Infoln("Established new database connection.")
 	}
 
+	ctx := context.Background()
+	if e.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.connectTimeout)
+		defer cancel()
+	}
+
 	// Always send a ping and possibly invalidate the connection if it fails
-	if err := e.dbConnection.Ping(); err != nil {
+	if err := e.dbConnection.PingContext(ctx); err != nil {
 		cerr := e.dbConnection.Close()
 		log.Infoln("Error while closing non-pinging DB connection:", cerr)
 		e.dbConnection = nil
 		e.psqlUp.Set(0)
 		return nil, err
 	}
+	e.lastConnected = time.Now()
 
 	return e.dbConnection, nil
 }
@@ -1041,21 +2672,22 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric) {
 	e.error.Set(0)
 	e.totalScrapes.Inc()
 
+	if err := queryTablespaceFree(ch, e.tablespacePaths); err != nil {
+		e.error.Set(1)
+	}
+
 	db, err := e.getDB(e.dsn)
 	if err != nil {
-		loggableDsn := "could not parse DATA_SOURCE_NAME"
-		// If the DSN is parseable, log it with a blanked out password
-		pDsn, pErr := url.Parse(e.dsn)
-		if pErr == nil {
-			// Blank user info if not nil
-			if pDsn.User != nil {
-				pDsn.User = url.UserPassword(pDsn.User.Username(), "PASSWORD_REMOVED")
-			}
-			loggableDsn = pDsn.String()
-		}
-		log.Infof("Error opening connection to database (%s): %s", loggableDsn, err)
+		log.Infof("Error opening connection to database (%s): %s", loggableDSN(e.dsn), err)
 		e.psqlUp.Set(0)
 		e.error.Set(1)
+
+		e.connMtx.Lock()
+		lastConnected := e.lastConnected
+		e.connMtx.Unlock()
+		if e.exitOnDBUnreachable > 0 && time.Since(lastConnected) > e.exitOnDBUnreachable && !e.inMaintenance() {
+			log.Fatalf("Database unreachable since %s, longer than %s, exiting.", lastConnected.Format(time.RFC3339), e.exitOnDBUnreachable)
+		}
 		return
 	}
 
@@ -1076,14 +2708,62 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric) {
 		e.error.Set(1)
 	}
 
-	errMap := queryNamespaceMappings(ch, db, e.metricMap, e.queryOverrides)
+	// Canceled when the scrape returns, stopping any query still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errMap := e.queryNamespaceMappings(ctx, ch, db, e.getReplicaDB(), "")
 	if len(errMap) > 0 {
 		e.error.Set(1)
 	}
+	e.counterResets.sweep()
+}
+
+// prepareDSN merges the connection flags into dsn, and sets its sslrootcert
+// to rootCert unless it is nil.
+func prepareDSN(dsn string, rootCert *string) (string, error) {
+	var err error
+	if rootCert != nil {
+		if dsn, err = setDSNParam(dsn, "sslrootcert", *rootCert); err != nil {
+			return "", fmt.Errorf("Adding sslrootcert to the datasource failed: %s", err)
+		}
+	}
+
+	if options := lookupEnvConfig("db.options", "PG_EXPORTER_DB_OPTIONS", *dbOptions); options != "" {
+		if dsn, err = addDSNOptions(dsn, options); err != nil {
+			return "", fmt.Errorf("Adding options to the datasource failed: %s", err)
+		}
+	}
+
+	if timeout := lookupConfig("db.lock-timeout-ms", *lockTimeoutMS).(int64); timeout > 0 {
+		if dsn, err = addDSNOptions(dsn, fmt.Sprintf("-c lock_timeout=%d", timeout)); err != nil {
+			return "", fmt.Errorf("Adding lock_timeout to the datasource failed: %s", err)
+		}
+	}
+
+	if timeout := lookupConfig("db.connect-timeout", *connectTimeout).(time.Duration); timeout > 0 {
+		// connect_timeout is in whole seconds
+		seconds := int(math.Ceil(timeout.Seconds()))
+		if dsn, err = setDSNParam(dsn, "connect_timeout", strconv.Itoa(seconds)); err != nil {
+			return "", fmt.Errorf("Adding connect_timeout to the datasource failed: %s", err)
+		}
+	}
+
+	if dsn, err = addKeepaliveParams(dsn); err != nil {
+		return "", fmt.Errorf("Adding keepalives to the datasource failed: %s", err)
+	}
+	return dsn, nil
 }
 
 func getDataSource() string {
 	var dsn = os.Getenv("DATA_SOURCE_NAME")
+	if path := lookupEnvConfig("data-source-file", "DATA_SOURCE_FILE", *dataSourceFile); dsn == "" && path != "" {
+		var err error
+		dsn, err = readDataSourceFile(path)
+		if err != nil {
+			panic(err)
+		}
+	}
 	if dsn == "" {
 		dsn = lookupConfig("dsn", "").(string)
 	}
@@ -1116,9 +2796,40 @@ func getDataSource() string {
 		dsn = "postgresql://" + ui + "@" + uri
 	}
 
+	dsn, err := addConnectionParams(dsn)
+	if err != nil {
+		log.Fatalf("Adding the [connection] parameters to the datasource failed: %s", err)
+	}
+
 	return dsn
 }
 
+// readDataSourceFile returns the DSN in the file at path, skipping blank lines
+// and lines starting with #. The DSN is that of the server /metrics scrapes;
+// other servers are scraped through /probe, whose targets come with each
+// request, so more than one DSN is an error.
+func readDataSourceFile(path string) (string, error) {
+	fileContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var dsn string
+	for _, line := range strings.Split(string(fileContents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if dsn != "" {
+			return "", fmt.Errorf("%s holds more than one DSN, scrape other servers through the probe path", path)
+		}
+		dsn = line
+	}
+	if dsn == "" {
+		return "", fmt.Errorf("%s holds no DSN", path)
+	}
+	return dsn, nil
+}
+
 func getStringEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -1161,13 +2872,182 @@ func main() {
 		log.Fatal(fmt.Sprintf("Load config file %s failed: %s", *configPath, err.Error()))
 	}
 
-	// set flags for exporter_shared server
+	// set flags for the web server
 	flag.Set("web.ssl-cert-file", lookupConfig("web.ssl-cert-file", "").(string))
 	flag.Set("web.ssl-key-file", lookupConfig("web.ssl-key-file", "").(string))
 	flag.Set("web.auth-file", lookupConfig("web.auth-file", "/opt/ss/ssm-client/ssm.yml").(string))
 
+	priority := lookupConfig("user-queries-priority", *userQueriesPriority).(string)
+	switch priority {
+	case userQueriesReplace, userQueriesPrepend, userQueriesAppend:
+	default:
+		log.Fatalf("Unknown user-queries-priority %q, must be one of: %s, %s, %s", priority, userQueriesReplace, userQueriesPrepend, userQueriesAppend)
+	}
+
+	if *checkConfig {
+		path := lookupConfig("query-path", *queriesPath).(string)
+		if path == "" {
+			fmt.Println("No custom queries to check")
+			return
+		}
+		if err := checkUserQueries(path, priority); err != nil {
+			fmt.Fprintf(os.Stderr, "Custom queries %s are invalid: %s\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Println("Custom queries", path, "are valid")
+		return
+	}
+
 	if lookupConfig("dumpmaps", *onlyDumpMaps).(bool) {
-		dumpMaps()
+		switch format := lookupConfig("dumpmaps-format", *dumpMapsFormat).(string); format {
+		case dumpMapsText:
+			dumpMaps()
+		case dumpMapsJSON:
+			if err := writeMapsJSON(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			log.Fatalf("Unknown dumpmaps-format %q, must be %s or %s", format, dumpMapsText, dumpMapsJSON)
+		}
+		return
+	}
+
+	compatName := lookupConfig("compat", *compat).(string)
+	if _, ok := compatModes[compatName]; compatName != "" && !ok {
+		log.Fatalf("Unknown compat %q, must be one of: %s", compatName, strings.Join(compatModeNames(), ", "))
+	}
+
+	tablespacePathMap, err := parseTablespacePaths(lookupConfig("collect.tablespace-free-paths", *tablespacePaths).(string))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	statStatementsCondition, err := statStatementsFilter(
+		lookupConfig("stat-statements.databases", *statStatementsDatabases).(string),
+		lookupConfig("stat-statements.users", *statStatementsUsers).(string),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	queryFilters := make(map[string]string)
+	if statStatementsCondition != "" {
+		queryFilters["pg_stat_statements"] = statStatementsCondition
+	}
+	userTablesCondition, err := userTablesFilter(lookupConfig("user-tables.exclude-schemas", *userTablesExcludeSchemas).(string))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if userTablesCondition != "" {
+		queryFilters["pg_stat_user_tables"] = userTablesCondition
+	}
+
+	renames, err := loadNamespaceRenames(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := validateNamespaceRenames(renames, knownMetricMaps(compatName)); err != nil {
+		log.Fatal(err)
+	}
+
+	relabelRules, err := loadRelabelRules(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	helpSuffix := lookupConfig("metric-help-suffix", *metricHelpSuffix).(string)
+
+	forcedUsages, err := parseForcedUsages(
+		lookupConfig("force-gauge", string(forceGauge)).(string),
+		lookupConfig("force-counter", string(forceCounter)).(string),
+		knownMetricMaps(compatName),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	droppedColumns, err := parseDropColumns(
+		lookupConfig("drop-columns", string(dropColumns)).(string),
+		knownMetricMaps(compatName),
+		lookupConfig("query-path", *queriesPath).(string),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	preferredReplicaNamespaces, err := parseReplicaNamespaces(
+		lookupConfig("replica-namespaces", string(replicaNamespaces)).(string),
+		knownMetricMaps(compatName),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	securityQuery, err := securityEventsQuery(lookupConfig("security-events.relation", *securityEventsRelation).(string))
+	if err != nil {
+		log.Fatal(err)
+	}
+	queryOverrides := map[string]string{securityEventsNamespace: securityQuery}
+
+	backendLimit := lookupConfig("per-backend.limit", *perBackendLimit).(int64)
+	if backendLimit <= 0 {
+		log.Fatal("--per-backend.limit must be positive")
+	}
+	queryLimits := map[string]int64{"pg_backend": backendLimit}
+
+	sequenceThreshold := lookupConfig("sequence-exhaustion.threshold", *sequenceExhaustionThreshold).(float64)
+	if sequenceThreshold < 0 || sequenceThreshold > 1 {
+		log.Fatal("--sequence-exhaustion.threshold must be between 0 and 1")
+	}
+	queryFilters["pg_sequence"] = fmt.Sprintf("usage_ratio >= %v", sequenceThreshold)
+
+	openConns := lookupConfig("db.max-open-conns", *maxOpenConns).(int64)
+	if openConns <= 0 {
+		log.Fatal("--db.max-open-conns must be positive")
+	}
+	idleConns := lookupConfig("db.max-idle-conns", *maxIdleConns).(int64)
+	if idleConns < 0 {
+		log.Fatal("--db.max-idle-conns must not be negative")
+	}
+
+	// Options shared by the exporter of the configured DSN and those of probed
+	// instances
+	opts := []ExporterOpt{
+		DisableDefaultMetrics(lookupConfig("disable-default-metrics", *disableDefaultMetrics).(bool)),
+		WithUserQueriesPath(lookupConfig("query-path", *queriesPath).(string)),
+		WithUserQueriesPriority(priority),
+		WithSearchPath(lookupEnvConfig("db.search-path", "PG_EXPORTER_DB_SEARCH_PATH", *searchPath)),
+		WithCollectors(enabledCollectors()),
+		WithCompat(compatName),
+		WithTablespacePaths(tablespacePathMap),
+		WithConnectTimeout(lookupConfig("db.connect-timeout", *connectTimeout).(time.Duration)),
+		WithQueryTimeout(lookupConfig("query-timeout", *queryTimeout).(time.Duration)),
+		WithMaxConnectionAge(lookupConfig("db.max-connection-age", *maxConnectionAge).(time.Duration)),
+		WithMaxOpenConns(int(openConns)),
+		WithMaxIdleConns(int(idleConns)),
+		WithSetRole(lookupEnvConfig("db.set-role", "PG_EXPORTER_DB_SET_ROLE", *setRole)),
+		WithQueryFilters(queryFilters),
+		WithQueryLimits(queryLimits),
+		WithQueryOverrides(queryOverrides),
+		WithNamespaceRenames(renames),
+		WithForcedUsages(forcedUsages),
+		WithDropColumns(droppedColumns),
+		WithDebugMetrics(lookupConfig("debug-metrics", *debugMetrics).(bool)),
+		WithNullLabelValue(lookupEnvConfig("null-label-value", "PG_EXPORTER_NULL_LABEL_VALUE", *nullLabelValue)),
+	}
+
+	if name := lookupConfig("dump-query", *dumpQuery).(string); name != "" {
+		version := lookupConfig("assume-pg-version", *assumePgVersion).(string)
+		if version == "" {
+			log.Fatal("--dump-query needs the PostgreSQL version to resolve the query for in --assume-pg-version")
+		}
+		pgVersion, err := semver.ParseTolerant(version)
+		if err != nil {
+			log.Fatalf("Invalid --assume-pg-version %q: %s", version, err)
+		}
+		query, err := NewExporter("", opts...).namespaceQuery(name, pgVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(query)
 		return
 	}
 
@@ -1176,39 +3056,212 @@ func main() {
 		log.Fatal("couldn't find environment variables describing the datasource to use")
 	}
 
-	exporter := NewExporter(dsn, lookupConfig("disable-default-metrics", *disableDefaultMetrics).(bool), lookupConfig("query-path", *queriesPath).(string))
-	defer func() {
-		if exporter.dbConnection != nil {
-			exporter.dbConnection.Close() // nolint: errcheck
+	rootCert, err := sslRootCert()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer removeSSLRootCert(rootCert)
+
+	if dsn, err = prepareDSN(dsn, rootCert); err != nil {
+		log.Fatal(err)
+	}
+
+	replica := lookupEnvConfig("replica-dsn", "PG_EXPORTER_REPLICA_DSN", *replicaDSN)
+	if replica != "" {
+		if replica, err = prepareDSN(replica, rootCert); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	exporter := NewExporter(
+		dsn,
+		append(opts,
+			WithReplicaDSN(replica),
+			WithReplicaNamespaces(preferredReplicaNamespaces),
+			WithExitOnDBUnreachable(lookupConfig("exit-on-db-unreachable", *exitOnDBUnreachable).(time.Duration)),
+			WithMaintenanceFile(
+				lookupEnvConfig("maintenance-file", "PG_EXPORTER_MAINTENANCE_FILE", *maintenanceFile),
+				lookupConfig("maintenance-suppress-errors", *maintenanceSuppressErrors).(bool),
+			),
+		)...,
+	)
+	defer exporter.closeConnections()
+
+	if retries := lookupConfig("startup-retries", *startupRetries).(int64); retries > 0 {
+		if err := exporter.waitForDB(retries, lookupConfig("startup-retry-interval", *startupRetryInterval).(time.Duration)); err != nil {
+			log.Warnln("Database still not reachable after the startup retries, serving metrics anyway:", err)
+		}
+	}
+
+	if lookupConfig("once", *once).(bool) {
+		if err := scrapeOnce(exporter, relabelRules, helpSuffix, os.Stdout, lookupConfig("push-gateway", *pushGateway).(string), lookupConfig("push-job", *pushJob).(string)); err != nil {
+			log.Errorln("Scraping once failed:", err)
+			os.Exit(1)
 		}
-	}()
+		return
+	}
 
 	prometheus.MustRegister(exporter)
+	go exporter.reloadOnSIGHUP()
 
-	// Use our shared code to run server and exit on error. Upstream's code below will not be executed.
-	exporter_shared.RunServer("PostgreSQL", lookupConfig("web.listen-address", *listenAddress).(string), lookupConfig("web.telemetry-path", *metricsPath).(string), promhttp.ContinueOnError)
+	// Run server and exit on error.
+	gatherer := helpSuffixGatherer{
+		gatherer: relabelGatherer{gatherer: prometheus.DefaultGatherer, rules: relabelRules},
+		suffix:   helpSuffix,
+	}
+	telemetryPath := lookupConfig("web.telemetry-path", *metricsPath).(string)
+	extra := make(map[string]http.Handler)
+	if lookupConfig("web.telemetry-path-by-tag", *telemetryPathByTag).(bool) {
+		prefix := strings.TrimSuffix(telemetryPath, "/") + "/"
+		extra[prefix] = &tagHandler{
+			exporter:   exporter,
+			prefix:     prefix,
+			rules:      relabelRules,
+			helpSuffix: helpSuffix,
+		}
+	}
+	if path := lookupConfig("web.probe-path", *probePath).(string); path != "" {
+		modules, err := loadAuthModules(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		extra[path] = &probeHandler{
+			modules:    modules,
+			rootCert:   rootCert,
+			opts:       opts,
+			rules:      relabelRules,
+			helpSuffix: helpSuffix,
+		}
+	}
+	runServer("PostgreSQL", lookupConfig("web.listen-address", *listenAddress).(string), telemetryPath, gatherer, promhttp.ContinueOnError, extra)
 }
 
 type config struct {
-	DSN                   string       `ini:"dsn"`
-	DisableDefaultMetrics bool         `ini:"disable-default-metrics"`
-	Dumpmaps              bool         `ini:"dumpmaps"`
-	Web                   webConfig    `ini:"web"`
-	Extend                extendConfig `ini:"extend"`
+	DSN                   string                   `ini:"dsn"`
+	DataSourceFile        string                   `ini:"data-source-file"`
+	DisableDefaultMetrics bool                     `ini:"disable-default-metrics"`
+	Dumpmaps              bool                     `ini:"dumpmaps"`
+	DumpmapsFormat        *string                  `ini:"dumpmaps-format"`
+	NullLabelValue        string                   `ini:"null-label-value"`
+	MetricHelpSuffix      string                   `ini:"metric-help-suffix"`
+	Compat                string                   `ini:"compat"`
+	UserQueriesPriority   *string                  `ini:"user-queries-priority"`
+	ReplicaDSN            string                   `ini:"replica-dsn"`
+	ReplicaNamespaces     string                   `ini:"replica-namespaces"`
+	ForceGauge            string                   `ini:"force-gauge"`
+	ForceCounter          string                   `ini:"force-counter"`
+	DropColumns           string                   `ini:"drop-columns"`
+	QueryTimeout          time.Duration            `ini:"query-timeout"`
+	ExitOnDBUnreachable   time.Duration            `ini:"exit-on-db-unreachable"`
+	MaintenanceFile       string                   `ini:"maintenance-file"`
+	MaintenanceSuppress   bool                     `ini:"maintenance-suppress-errors"`
+	DebugMetrics          bool                     `ini:"debug-metrics"`
+	StartupRetries        int64                    `ini:"startup-retries"`
+	StartupRetryInterval  *time.Duration           `ini:"startup-retry-interval"`
+	Once                  bool                     `ini:"once"`
+	PushGateway           string                   `ini:"push-gateway"`
+	PushJob               *string                  `ini:"push-job"`
+	Web                   webConfig                `ini:"web"`
+	Extend                extendConfig             `ini:"extend"`
+	DB                    dbConfig                 `ini:"db"`
+	Collect               collectConfig            `ini:"collect"`
+	StatStatements        statStatementsConfig     `ini:"stat-statements"`
+	PerBackend            perBackendConfig         `ini:"per-backend"`
+	SequenceExhaustion    sequenceExhaustionConfig `ini:"sequence-exhaustion"`
+	UserTables            userTablesConfig         `ini:"user-tables"`
+	SecurityEvents        securityEventsConfig     `ini:"security-events"`
+	Connection            connectionConfig         `ini:"connection"`
 }
 
 type webConfig struct {
-	ListenAddress string  `ini:"listen-address"`
-	MetricsPath   string  `ini:"telemetry-path"`
-	SSLCertFile   string  `ini:"ssl-cert-file"`
-	SSLKeyFile    string  `ini:"ssl-key-file"`
-	AuthFile      *string `ini:"auth-file"`
+	ListenAddress     string        `ini:"listen-address"`
+	MetricsPath       string        `ini:"telemetry-path"`
+	SSLCertFile       string        `ini:"ssl-cert-file"`
+	SSLKeyFile        string        `ini:"ssl-key-file"`
+	AuthFile          *string       `ini:"auth-file"`
+	MinScrapeInterval time.Duration `ini:"min-scrape-interval"`
+	ProbePath         *string       `ini:"probe-path"`
+	PathByTag         bool          `ini:"telemetry-path-by-tag"`
 }
 
 type extendConfig struct {
 	QueryPath string `ini:"query-path"`
 }
 
+type collectConfig struct {
+	StatStatements     bool   `ini:"stat-statements"`
+	StandbyNames       bool   `ini:"standby-names"`
+	QueryAge           bool   `ini:"query-age-quantiles"`
+	RelationSizes      bool   `ini:"relation-sizes"`
+	AutovacuumEligible bool   `ini:"autovacuum-eligible"`
+	AutovacuumDisabled bool   `ini:"autovacuum-disabled-tables"`
+	VacuumBlockers     bool   `ini:"vacuum-blockers"`
+	LWLockWaits        bool   `ini:"lwlock-waits"`
+	Cursors            bool   `ini:"cursors"`
+	DerivedRatios      bool   `ini:"derived-ratios"`
+	ActivityClients    bool   `ini:"activity-clients"`
+	ActivityByApp      bool   `ini:"activity-by-application"`
+	MissingPK          bool   `ini:"missing-pk"`
+	ParallelWorkers    bool   `ini:"parallel-workers"`
+	PerBackend         bool   `ini:"per-backend"`
+	SecurityEvents     bool   `ini:"security-events"`
+	ProgressBasebackup bool   `ini:"progress-basebackup"`
+	TempTables         bool   `ini:"temp-tables"`
+	SSL                bool   `ini:"ssl"`
+	SequenceExhaustion bool   `ini:"sequence-exhaustion"`
+	UserTables         bool   `ini:"user-tables"`
+	TablespacePaths    string `ini:"tablespace-free-paths"`
+}
+
+type statStatementsConfig struct {
+	Databases string `ini:"databases"`
+	Users     string `ini:"users"`
+}
+
+type securityEventsConfig struct {
+	Relation *string `ini:"relation"`
+}
+
+type perBackendConfig struct {
+	Limit *int64 `ini:"limit"`
+}
+
+type sequenceExhaustionConfig struct {
+	Threshold *float64 `ini:"threshold"`
+}
+
+type userTablesConfig struct {
+	ExcludeSchemas *string `ini:"exclude-schemas"`
+}
+
+type connectionConfig struct {
+	SSLMode     string `ini:"sslmode"`
+	SSLRootCert string `ini:"sslrootcert"`
+	SSLCert     string `ini:"sslcert"`
+	SSLKey      string `ini:"sslkey"`
+}
+
+type dbConfig struct {
+	SearchPath string `ini:"search-path"`
+	Options    string `ini:"options"`
+
+	ConnectTimeout time.Duration `ini:"connect-timeout"`
+	SetRole        string        `ini:"set-role"`
+	LockTimeoutMS  int64         `ini:"lock-timeout-ms"`
+
+	MaxConnectionAge time.Duration `ini:"max-connection-age"`
+	MaxOpenConns     *int64        `ini:"max-open-conns"`
+	MaxIdleConns     *int64        `ini:"max-idle-conns"`
+
+	Keepalives         *bool         `ini:"keepalives"`
+	KeepalivesIdle     time.Duration `ini:"keepalives-idle"`
+	KeepalivesInterval time.Duration `ini:"keepalives-interval"`
+	KeepalivesCount    int64         `ini:"keepalives-count"`
+
+	SSLCAInline       string `ini:"ssl-ca-inline"`
+	SSLUseSystemRoots bool   `ini:"ssl-use-system-roots"`
+}
+
 // lookupConfig lookup config from flag
 // or config by name, returns nil if none exists.
 // name should be in this format -> '[section].[key]'
@@ -1243,7 +3296,13 @@ func lookupConfig(name string, defaultValue interface{}) interface{} {
 
 		v := reflect.ValueOf(cfg).Elem().Field(i)
 		if section == "" {
-			return v.Interface()
+			if v.Kind() != reflect.Ptr {
+				return v.Interface()
+			}
+			if v.IsNil() {
+				return defaultValue
+			}
+			return v.Elem().Interface()
 		}
 
 		if !v.CanAddr() {
@@ -1273,10 +3332,30 @@ func lookupConfig(name string, defaultValue interface{}) interface{} {
 	return defaultValue
 }
 
+// lookupEnvConfig looks up a string option which can also be set with the
+// environment variable env. The flag wins, then a non-empty value of the
+// config file, whose sample lists every key with an empty value, then env.
+func lookupEnvConfig(name, env string, defaultValue string) string {
+	if flagSet, flagValue := lookupFlag(name); flagSet {
+		return flagValue.(string)
+	}
+	if value := lookupConfig(name, "").(string); value != "" {
+		return value
+	}
+	return getStringEnv(env, defaultValue)
+}
+
 func lookupFlag(name string) (flagSet bool, flagValue interface{}) {
 	flag.Visit(func(f *flag.Flag) {
 		if f.Name == name {
 			flagSet = true
+			// Durations are int64 underneath, but should be returned as is
+			if getter, ok := f.Value.(flag.Getter); ok {
+				if d, ok := getter.Get().(time.Duration); ok {
+					flagValue = d
+					return
+				}
+			}
 			switch reflect.Indirect(reflect.ValueOf(f.Value)).Kind() {
 			case reflect.Bool:
 				flagValue = reflect.Indirect(reflect.ValueOf(f.Value)).Bool()
@@ -1338,6 +3417,11 @@ func configure() error {
 				continue
 			}
 
+			if d, ok := flagValue.(time.Duration); ok {
+				iniCfg.Section(section).Key(key).SetValue(d.String())
+				continue
+			}
+
 			if fieldValue.IsValid() && fieldValue.CanSet() {
 				switch fieldValue.Kind() {
 				case reflect.Bool:
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+	"gopkg.in/ini.v1"
+)
+
+var probePath = flag.String(
+	"web.probe-path", "/probe",
+	"Path under which to scrape the instance given in the target parameter, with the credentials of the auth_module parameter. Empty disables probing.",
+)
+
+// authModuleSectionPrefix prefixes the name of the config file sections
+// holding the credentials probed instances are connected with, e.g.
+// [auth_module.monitoring].
+const authModuleSectionPrefix = "auth_module."
+
+// probeDefaultDatabase is the database connected to when a probe does not
+// name one.
+const probeDefaultDatabase = "postgres"
+
+// authModule holds the credentials and connection parameters to connect to
+// a probed instance with.
+type authModule struct {
+	user     string
+	password string
+	// Other connection parameters, e.g. sslmode
+	params map[string]string
+}
+
+// loadAuthModules reads the auth module sections of the config file.
+func loadAuthModules(path string) (map[string]authModule, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]authModule)
+	for _, section := range f.Sections() {
+		if !strings.HasPrefix(section.Name(), authModuleSectionPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(section.Name(), authModuleSectionPrefix)
+
+		module := authModule{params: make(map[string]string)}
+		for key, value := range section.KeysHash() {
+			switch key {
+			case "user":
+				module.user = value
+			case "password":
+				module.password = value
+			case "host", "port", "dbname":
+				return nil, fmt.Errorf("auth module %s: %s is taken from the probe request", name, key)
+			default:
+				module.params[key] = value
+			}
+		}
+		modules[name] = module
+	}
+	return modules, nil
+}
+
+// dsn returns the DSN to connect to database on target, a host with an
+// optional port, with the credentials of the module.
+func (m authModule) dsn(target, database string) (string, error) {
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(target, "/?#@ ") {
+		return "", fmt.Errorf("invalid target %q", target)
+	}
+
+	u := url.URL{Scheme: "postgresql", Host: target, Path: "/" + database}
+	if m.password != "" {
+		u.User = url.UserPassword(m.user, m.password)
+	} else if m.user != "" {
+		u.User = url.User(m.user)
+	}
+	q := make(url.Values)
+	for key, value := range m.params {
+		q.Set(key, value)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// probeHandler scrapes the instance given in the target parameter of each
+// request, like the /probe endpoint of blackbox_exporter. The credentials
+// come from the auth module named by the auth_module parameter, never from
+// the request.
+type probeHandler struct {
+	modules    map[string]authModule
+	rootCert   *string
+	opts       []ExporterOpt
+	rules      []relabelRule
+	helpSuffix string
+}
+
+// ServeHTTP implements http.Handler.
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "The target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := params.Get("auth_module")
+	module, ok := h.modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown auth_module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	database := params.Get("database")
+	if database == "" {
+		database = probeDefaultDatabase
+	}
+
+	dsn, err := module.dsn(target, database)
+	if err == nil {
+		dsn, err = prepareDSN(dsn, h.rootCert)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exporter := NewExporter(dsn, h.opts...)
+	defer exporter.closeConnections()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	gatherer := helpSuffixGatherer{
+		gatherer: relabelGatherer{gatherer: registry, rules: h.rules},
+		suffix:   h.helpSuffix,
+	}
+	promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
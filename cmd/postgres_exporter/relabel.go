@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"gopkg.in/ini.v1"
+)
+
+// relabelSection is the config file section holding one relabel rule. It can
+// be repeated, the rules are applied in order.
+const relabelSection = "relabel"
+
+// metricNameLabel is the pseudo-label holding the metric name in rules.
+const metricNameLabel = "__name__"
+
+// Relabel actions, following the relabel_configs of Prometheus.
+const (
+	relabelReplace   = "replace"
+	relabelKeep      = "keep"
+	relabelDrop      = "drop"
+	relabelLabelDrop = "labeldrop"
+	relabelLabelKeep = "labelkeep"
+)
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// relabelRule rewrites, keeps or drops the metrics its regex matches.
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// loadRelabelRules reads the relabel sections of the config file.
+func loadRelabelRules(path string) ([]relabelRule, error) {
+	// Separators and regexes commonly contain ; and #
+	f, err := ini.LoadSources(ini.LoadOptions{AllowNonUniqueSections: true, IgnoreInlineComment: true}, path)
+	if err != nil {
+		return nil, err
+	}
+	sections, err := f.SectionsByName(relabelSection)
+	if err != nil {
+		// No rules
+		return nil, nil
+	}
+
+	rules := make([]relabelRule, 0, len(sections))
+	for i, section := range sections {
+		rule, err := parseRelabelRule(section.KeysHash())
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %s", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseRelabelRule parses the keys of a relabel section, defaulting them like
+// Prometheus does.
+func parseRelabelRule(keys map[string]string) (relabelRule, error) {
+	rule := relabelRule{
+		separator:   ";",
+		replacement: "$1",
+		action:      relabelReplace,
+	}
+	expr := "(.*)"
+
+	for key, value := range keys {
+		switch key {
+		case "source_labels":
+			for _, label := range strings.Split(value, ",") {
+				if label = strings.TrimSpace(label); label != "" {
+					rule.sourceLabels = append(rule.sourceLabels, label)
+				}
+			}
+		case "separator":
+			rule.separator = value
+		case "regex":
+			expr = value
+		case "target_label":
+			rule.targetLabel = value
+		case "replacement":
+			rule.replacement = value
+		case "action":
+			rule.action = value
+		default:
+			return relabelRule{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+
+	regex, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return relabelRule{}, fmt.Errorf("invalid regex %q: %s", expr, err)
+	}
+	rule.regex = regex
+
+	switch rule.action {
+	case relabelReplace:
+		if rule.targetLabel != metricNameLabel && !labelNameRegex.MatchString(rule.targetLabel) {
+			return relabelRule{}, fmt.Errorf("invalid target_label %q", rule.targetLabel)
+		}
+	case relabelKeep, relabelDrop:
+		if len(rule.sourceLabels) == 0 {
+			return relabelRule{}, fmt.Errorf("action %s needs source_labels", rule.action)
+		}
+	case relabelLabelDrop, relabelLabelKeep:
+	default:
+		return relabelRule{}, fmt.Errorf("unknown action %q", rule.action)
+	}
+	return rule, nil
+}
+
+// relabel applies rules to labels, which include the metric name as
+// __name__. It returns false if the metric is dropped.
+func relabel(labels map[string]string, rules []relabelRule) bool {
+	for _, rule := range rules {
+		values := make([]string, len(rule.sourceLabels))
+		for i, label := range rule.sourceLabels {
+			values[i] = labels[label]
+		}
+		value := strings.Join(values, rule.separator)
+
+		switch rule.action {
+		case relabelReplace:
+			indexes := rule.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(rule.regex.ExpandString(nil, rule.replacement, value, indexes))
+			if target == "" {
+				delete(labels, rule.targetLabel)
+				continue
+			}
+			labels[rule.targetLabel] = target
+		case relabelKeep:
+			if !rule.regex.MatchString(value) {
+				return false
+			}
+		case relabelDrop:
+			if rule.regex.MatchString(value) {
+				return false
+			}
+		case relabelLabelDrop, relabelLabelKeep:
+			// The metric name is not a label to drop
+			for name := range labels {
+				if name != metricNameLabel && rule.regex.MatchString(name) == (rule.action == relabelLabelDrop) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// relabelGatherer applies relabel rules to the metrics of a gatherer, so
+// they apply to every metric exposed.
+type relabelGatherer struct {
+	gatherer prometheus.Gatherer
+	rules    []relabelRule
+}
+
+// Gather implements prometheus.Gatherer.
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.gatherer.Gather()
+	return relabelFamilies(mfs, g.rules), err
+}
+
+// relabelFamilies applies rules to the metrics of mfs. Metrics renamed to the
+// name of another family join it if they are of the same type, and metrics
+// ending up with the labels of a metric already kept are dropped, so the
+// result stays consistent.
+func relabelFamilies(mfs []*dto.MetricFamily, rules []relabelRule) []*dto.MetricFamily {
+	if len(rules) == 0 {
+		return mfs
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	seen := make(map[string]bool)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := map[string]string{metricNameLabel: mf.GetName()}
+			for _, pair := range m.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if !relabel(labels, rules) {
+				continue
+			}
+
+			name := labels[metricNameLabel]
+			delete(labels, metricNameLabel)
+			if !metricPrefixRegex.MatchString(name) {
+				log.Debugln("Dropping metric relabeled to invalid name", name)
+				continue
+			}
+
+			family, ok := families[name]
+			if !ok {
+				family = &dto.MetricFamily{Name: &name, Help: mf.Help, Type: mf.Type}
+				families[name] = family
+			} else if family.GetType() != mf.GetType() {
+				log.Debugln("Dropping", mf.GetName(), "metric relabeled to", name, "of another type")
+				continue
+			}
+
+			m.Label = labelPairs(labels)
+			key := name
+			for _, pair := range m.Label {
+				key += "\xff" + pair.GetName() + "\xff" + pair.GetValue()
+			}
+			if seen[key] {
+				log.Debugln("Dropping duplicate", name, "metric after relabeling")
+				continue
+			}
+			seen[key] = true
+			family.Metric = append(family.Metric, m)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		result = append(result, families[name])
+	}
+	return result
+}
+
+// labelPairs returns labels as label pairs sorted by name.
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]*dto.LabelPair, 0, len(names))
+	for _, name := range names {
+		name, value := name, labels[name]
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return pairs
+}
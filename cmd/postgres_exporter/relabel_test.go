@@ -0,0 +1,111 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	dto "github.com/prometheus/client_model/go"
+	. "gopkg.in/check.v1"
+)
+
+type RelabelSuite struct{}
+
+var _ = Suite(&RelabelSuite{})
+
+func (s *RelabelSuite) TestLoadRelabelRules(c *C) {
+	path := filepath.Join(c.MkDir(), "postgres_exporter.conf")
+	c.Assert(ioutil.WriteFile(path, []byte(`dsn =
+
+[relabel]
+source_labels = __name__
+regex = pg_stat_database_.*;?
+action = drop
+
+[relabel]
+source_labels = datname
+target_label = db
+`), 0600), IsNil)
+
+	rules, err := loadRelabelRules(path)
+	c.Assert(err, IsNil)
+	c.Assert(rules, HasLen, 2)
+	c.Check(rules[0].action, Equals, relabelDrop)
+	c.Check(rules[0].regex.String(), Equals, `^(?:pg_stat_database_.*;?)$`)
+	c.Check(rules[1].action, Equals, relabelReplace)
+	c.Check(rules[1].sourceLabels, DeepEquals, []string{"datname"})
+	c.Check(rules[1].replacement, Equals, "$1")
+}
+
+func (s *RelabelSuite) TestParseRelabelRuleInvalid(c *C) {
+	for _, t := range []struct {
+		keys map[string]string
+		err  string
+	}{
+		{map[string]string{"source_labels": "datname"}, `invalid target_label ""`},
+		{map[string]string{"action": "drop"}, `action drop needs source_labels`},
+		{map[string]string{"action": "hashmod"}, `unknown action "hashmod"`},
+		{map[string]string{"regex": "(", "action": "labeldrop"}, `invalid regex.*`},
+		{map[string]string{"modulus": "2"}, `unknown key "modulus"`},
+	} {
+		_, err := parseRelabelRule(t.keys)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *RelabelSuite) TestRelabel(c *C) {
+	rule := func(keys map[string]string) relabelRule {
+		r, err := parseRelabelRule(keys)
+		c.Assert(err, IsNil)
+		return r
+	}
+	rules := []relabelRule{
+		rule(map[string]string{"source_labels": "__name__", "regex": "pg_locks_count", "action": "drop"}),
+		rule(map[string]string{"source_labels": "__name__", "regex": "pg_stat_database_(.*)", "target_label": "__name__", "replacement": "pg_db_$1"}),
+		rule(map[string]string{"source_labels": "datname,datid", "separator": "/", "target_label": "database"}),
+		rule(map[string]string{"regex": "datid|datname", "action": "labeldrop"}),
+	}
+
+	labels := map[string]string{"__name__": "pg_stat_database_deadlocks", "datname": "app", "datid": "16384"}
+	c.Check(relabel(labels, rules), Equals, true)
+	c.Check(labels, DeepEquals, map[string]string{"__name__": "pg_db_deadlocks", "database": "app/16384"})
+
+	c.Check(relabel(map[string]string{"__name__": "pg_locks_count"}, rules), Equals, false)
+
+	keep := []relabelRule{rule(map[string]string{"source_labels": "datname", "regex": "app", "action": "keep"})}
+	c.Check(relabel(map[string]string{"__name__": "pg_up"}, keep), Equals, false)
+	c.Check(relabel(map[string]string{"__name__": "pg_up", "datname": "app"}, keep), Equals, true)
+
+	labels = map[string]string{"__name__": "pg_up", "datname": "app", "server": "a"}
+	c.Check(relabel(labels, []relabelRule{rule(map[string]string{"regex": "datname", "action": "labelkeep"})}), Equals, true)
+	c.Check(labels, DeepEquals, map[string]string{"__name__": "pg_up", "datname": "app"})
+}
+
+func (s *RelabelSuite) TestRelabelFamilies(c *C) {
+	gauge := dto.MetricType_GAUGE
+	metric := func(value float64, labels ...string) *dto.Metric {
+		m := &dto.Metric{Gauge: &dto.Gauge{Value: &value}}
+		for i := 0; i < len(labels); i += 2 {
+			m.Label = append(m.Label, &dto.LabelPair{Name: &labels[i], Value: &labels[i+1]})
+		}
+		return m
+	}
+	name := func(s string) *string { return &s }
+	mfs := []*dto.MetricFamily{
+		{Name: name("pg_b"), Type: &gauge, Metric: []*dto.Metric{metric(1, "datname", "app"), metric(2, "datname", "other")}},
+		{Name: name("pg_a"), Type: &gauge, Metric: []*dto.Metric{metric(3, "datname", "app")}},
+	}
+	rule, err := parseRelabelRule(map[string]string{"regex": "datname", "action": "labeldrop"})
+	c.Assert(err, IsNil)
+
+	result := relabelFamilies(mfs, []relabelRule{rule})
+	c.Assert(result, HasLen, 2)
+	c.Check(result[0].GetName(), Equals, "pg_a")
+	c.Check(result[1].GetName(), Equals, "pg_b")
+	// Dropping the only differing label makes the second pg_b a duplicate
+	c.Assert(result[1].Metric, HasLen, 1)
+	c.Check(result[1].Metric[0].GetGauge().GetValue(), Equals, float64(1))
+	c.Check(result[1].Metric[0].Label, HasLen, 0)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"gopkg.in/ini.v1"
+)
+
+// renameSection is the config file section mapping namespaces to the prefix
+// their metrics are renamed to, e.g. pg_stat_database = pg_db.
+const renameSection = "rename"
+
+var metricPrefixRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// loadNamespaceRenames reads the rename section of the config file.
+func loadNamespaceRenames(path string) (map[string]string, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	section, err := f.GetSection(renameSection)
+	if err != nil {
+		// No renames
+		return nil, nil
+	}
+	return section.KeysHash(), nil
+}
+
+// knownMetricMaps returns the builtin metric maps, with those of the compat
+// mode and of every optional collector merged in.
+func knownMetricMaps(compatName string) map[string]map[string]ColumnMapping {
+	metricMaps := make(map[string]map[string]ColumnMapping)
+	for k, v := range builtinMetricMaps {
+		metricMaps[k] = v
+	}
+	for k, v := range compatModes[compatName].metricMaps {
+		metricMaps[k] = v
+	}
+	for _, collector := range optionalCollectors {
+		for k, v := range collector.metricMaps {
+			metricMaps[k] = v
+		}
+	}
+	return metricMaps
+}
+
+// validateNamespaceRenames checks that every renamed namespace exists in
+// metricMaps, is renamed to a valid metric name prefix, and that no two
+// metrics end up with the same name.
+func validateNamespaceRenames(renames map[string]string, metricMaps map[string]map[string]ColumnMapping) error {
+	for from, to := range renames {
+		if _, ok := metricMaps[from]; !ok {
+			return fmt.Errorf("cannot rename unknown namespace %q", from)
+		}
+		if !metricPrefixRegex.MatchString(to) {
+			return fmt.Errorf("cannot rename namespace %q to invalid metric name prefix %q", from, to)
+		}
+	}
+
+	// Sorted so the error names the same namespaces on every run
+	namespaces := make([]string, 0, len(metricMaps))
+	for namespace := range metricMaps {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	fixedNames := collectorMetricNames()
+	names := make(map[string]string)
+	for _, namespace := range namespaces {
+		prefix := namespace
+		if to, ok := renames[namespace]; ok {
+			prefix = to
+		}
+		for column, mapping := range metricMaps[namespace] {
+			if mapping.usage == DISCARD || mapping.usage == LABEL {
+				continue
+			}
+			name := fmt.Sprintf("%s_%s", prefix, column)
+			if fixed, ok := fixedNames[namespace+"."+column]; ok {
+				name = fixed
+			}
+			for _, name := range exportedNames(name, mapping.usage) {
+				if other, ok := names[name]; ok && other != namespace {
+					return fmt.Errorf("renaming makes namespaces %q and %q both export %s", other, namespace, name)
+				}
+				names[name] = namespace
+			}
+		}
+	}
+	return nil
+}
+
+// exportedNames returns the names of the metrics exported for a column of
+// the given usage whose metric is named name.
+func exportedNames(name string, usage ColumnUsage) []string {
+	switch usage {
+	case DURATION:
+		return []string{name + "_milliseconds"}
+	case COUNTERRESETTABLE:
+		return []string{name, name + "_resets_total"}
+	case RESETTIMESTAMP:
+		return []string{name, name + "_total"}
+	}
+	return []string{name}
+}
@@ -0,0 +1,95 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type RenameSuite struct{}
+
+var _ = Suite(&RenameSuite{})
+
+func (s *RenameSuite) TestLoadNamespaceRenames(c *C) {
+	path := filepath.Join(c.MkDir(), "postgres_exporter.conf")
+	c.Assert(ioutil.WriteFile(path, []byte("dsn =\n"), 0600), IsNil)
+	renames, err := loadNamespaceRenames(path)
+	c.Assert(err, IsNil)
+	c.Check(renames, HasLen, 0)
+
+	c.Assert(ioutil.WriteFile(path, []byte("dsn =\n[rename]\npg_stat_database = pg_db\n"), 0600), IsNil)
+	renames, err = loadNamespaceRenames(path)
+	c.Assert(err, IsNil)
+	c.Check(renames, DeepEquals, map[string]string{"pg_stat_database": "pg_db"})
+}
+
+func (s *RenameSuite) TestValidateNamespaceRenames(c *C) {
+	// The metrics known to the exporter do not collide by themselves
+	for _, compat := range append(compatModeNames(), "") {
+		c.Check(validateNamespaceRenames(nil, knownMetricMaps(compat)), IsNil, Commentf("compat %q", compat))
+	}
+	c.Check(validateNamespaceRenames(map[string]string{"pg_stat_database": "pg_db"}, knownMetricMaps("")), IsNil)
+
+	c.Check(validateNamespaceRenames(map[string]string{"pg_unknown": "pg_db"}, knownMetricMaps("")),
+		ErrorMatches, `cannot rename unknown namespace "pg_unknown"`)
+	c.Check(validateNamespaceRenames(map[string]string{"pg_stat_database": "pg-db"}, knownMetricMaps("")),
+		ErrorMatches, `.*invalid metric name prefix "pg-db"`)
+
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_a": {"datname": {LABEL, "", nil, nil}, "count": {GAUGE, "", nil, nil}},
+		"pg_b": {"count": {GAUGE, "", nil, nil}},
+	}
+	c.Check(validateNamespaceRenames(map[string]string{"pg_a": "pg_b"}, metricMaps),
+		ErrorMatches, `renaming makes namespaces "pg_a" and "pg_b" both export pg_b_count`)
+}
+
+func (s *RenameSuite) TestValidateNamespaceRenamesSuffixes(c *C) {
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_a": {"wait": {DURATION, "", nil, nil}, "writes": {COUNTERRESETTABLE, "", nil, nil}},
+		"pg_b": {"wait_milliseconds": {GAUGE, "", nil, nil}},
+		"pg_c": {"writes_resets_total": {COUNTER, "", nil, nil}},
+	}
+	c.Check(validateNamespaceRenames(map[string]string{"pg_a": "pg_b"}, metricMaps),
+		ErrorMatches, `renaming makes namespaces "pg_a" and "pg_b" both export pg_b_wait_milliseconds`)
+	c.Check(validateNamespaceRenames(map[string]string{"pg_a": "pg_c"}, metricMaps),
+		ErrorMatches, `renaming makes namespaces "pg_a" and "pg_c" both export pg_c_writes_resets_total`)
+}
+
+func (s *RenameSuite) TestMakeDescMapRenames(c *C) {
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_stat_database": {"numbackends": {GAUGE, "Backends", nil, nil}},
+	}
+	descMap := makeDescMap(semver.MustParse("10.0.0"), metricMaps, descMapOptions{renames: map[string]string{"pg_stat_database": "pg_db"}})
+	// The namespace, which the query is looked up by, is kept
+	desc := descMap["pg_stat_database"].columnMappings["numbackends"].desc.String()
+	c.Check(strings.Contains(desc, `fqName: "pg_db_numbackends"`), Equals, true, Commentf("%s", desc))
+}
+
+func (s *RenameSuite) TestUnknownColumnRenamed(c *C) {
+	db := sql.OpenDB(failingRowsDriver{err: io.EOF})
+	defer db.Close() // nolint: errcheck
+
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_stat_database": {"numbackends": {GAUGE, "Backends", nil, nil}},
+	}
+	descMap := makeDescMap(semver.MustParse("10.0.0"), metricMaps, descMapOptions{renames: map[string]string{"pg_stat_database": "pg_db"}})
+	e := NewExporter("", DisableDefaultMetrics(true))
+	ch := make(chan prometheus.Metric, 10)
+	_, errs, err := e.queryNamespace(context.Background(), ch, db, "pg_stat_database", descMap["pg_stat_database"], "SELECT 1 AS value", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(errs, HasLen, 0)
+	close(ch)
+
+	metric := <-ch
+	c.Check(metric.Desc().String(), Matches, `.*fqName: "pg_db_value".*`)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var replicaNamespaces listFlag
+
+func init() {
+	flag.Var(&replicaNamespaces, "replica-namespaces", "Builtin or collector namespace to run against --replica-dsn, like custom queries marked prefer_replica. Repeatable, or comma separated.")
+}
+
+// parseReplicaNamespaces parses the comma separated list of the namespaces
+// preferring the replica, which must be in metricMaps.
+func parseReplicaNamespaces(s string, metricMaps map[string]map[string]ColumnMapping) (map[string]bool, error) {
+	namespaces := make(map[string]bool)
+	for _, namespace := range strings.Split(s, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		if _, ok := metricMaps[namespace]; !ok {
+			return nil, fmt.Errorf("invalid --replica-namespaces %q, no such namespace", namespace)
+		}
+		namespaces[namespace] = true
+	}
+	return namespaces, nil
+}
+
+// preferReplica marks the namespaces of metricMap in namespaces as preferring
+// the replica.
+func preferReplica(metricMap map[string]MetricMapNamespace, namespaces map[string]bool) {
+	for namespace := range namespaces {
+		if mapping, ok := metricMap[namespace]; ok {
+			mapping.preferReplica = true
+			metricMap[namespace] = mapping
+		}
+	}
+}
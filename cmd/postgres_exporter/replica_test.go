@@ -0,0 +1,50 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"sync"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type ReplicaSuite struct{}
+
+var _ = Suite(&ReplicaSuite{})
+
+func (s *ReplicaSuite) TestParseReplicaNamespaces(c *C) {
+	namespaces, err := parseReplicaNamespaces("pg_stat_database, pg_stat_statements,", knownMetricMaps(""))
+	c.Assert(err, IsNil)
+	c.Check(namespaces, DeepEquals, map[string]bool{"pg_stat_database": true, "pg_stat_statements": true})
+
+	_, err = parseReplicaNamespaces("pg_missing", knownMetricMaps(""))
+	c.Check(err, ErrorMatches, `invalid --replica-namespaces "pg_missing", no such namespace`)
+}
+
+func (s *ReplicaSuite) TestReplicaNamespacesLoaded(c *C) {
+	e := NewExporter("", WithReplicaNamespaces(map[string]bool{"pg_stat_database": true, "pg_missing": true}))
+	c.Assert(e.loadMaps(semver.MustParse("10.0.0")), IsNil)
+
+	c.Check(e.metricMap["pg_stat_database"].preferReplica, Equals, true)
+	c.Check(e.metricMap["pg_stat_bgwriter"].preferReplica, Equals, false)
+	_, ok := e.metricMap["pg_missing"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *ReplicaSuite) TestUnreachableReplica(c *C) {
+	// Nothing listens on port 1, so the replica cannot be reached
+	e := NewExporter("", WithReplicaDSN("host=127.0.0.1 port=1 sslmode=disable"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Check(e.getReplicaDB(), IsNil)
+		}()
+	}
+	wg.Wait()
+	c.Check(e.replicaConnection, IsNil)
+}
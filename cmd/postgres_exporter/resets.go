@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// counterResets detects resets of COUNTER_RESETTABLE and RESET_TIMESTAMP
+// columns by comparing each series with its value of the previous scrape. It
+// also averages columns over the change of another between scrapes.
+type counterResets struct {
+	mtx    sync.Mutex
+	series map[string]*counterState
+	// failed holds the namespaces which failed to scrape since the last
+	// sweep, whose series are kept even if they were not observed
+	failed map[string]bool
+}
+
+// counterState is what is remembered of a series between scrapes.
+type counterState struct {
+	namespace string
+	last      float64
+	lastCount float64 // Previous value of the column averaged over
+	resets    float64
+	seen      bool // Whether the series was observed since the last sweep
+}
+
+func newCounterResets() *counterResets {
+	return &counterResets{series: make(map[string]*counterState), failed: make(map[string]bool)}
+}
+
+// observe records value for the series of metric with labels, and returns the
+// number of times the series decreased since it was first observed.
+func (r *counterResets) observe(namespace, metric string, labels []string, value float64) float64 {
+	return r.count(namespace, metric, labels, value, func(last float64) bool {
+		return value < last
+	})
+}
+
+// observeChange records value for the series of metric with labels, and
+// returns the number of times the series changed since it was first observed.
+// A timestamp which was never set, NaN, becoming set is not a change.
+func (r *counterResets) observeChange(namespace, metric string, labels []string, value float64) float64 {
+	return r.count(namespace, metric, labels, value, func(last float64) bool {
+		return value != last
+	})
+}
+
+// count records value for the series of metric with labels, counting a reset
+// if reset returns true for the previous value. NULL values, NaN, are
+// skipped: the next value is compared with the one before them, and the first
+// value which is not NULL is not compared at all.
+func (r *counterResets) count(namespace, metric string, labels []string, value float64, reset func(last float64) bool) float64 {
+	key := metric + "\xff" + strings.Join(labels, "\xff")
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s, ok := r.series[key]
+	if !ok {
+		s = &counterState{namespace: namespace, last: math.NaN()}
+		r.series[key] = s
+	}
+	if !math.IsNaN(value) {
+		if !math.IsNaN(s.last) && reset(s.last) {
+			s.resets++
+		}
+		s.last = value
+	}
+	s.seen = true
+	return s.resets
+}
+
+// average records the totals value and count for the series of metric with
+// labels, and returns the change of value since the previous scrape divided by
+// that of count. It is NaN on the first scrape, when count did not increase,
+// e.g. no checkpoint happened, or when either decreased since the statistics
+// were reset. NULL values, NaN, are skipped like in count.
+func (r *counterResets) average(namespace, metric string, labels []string, value, count float64) float64 {
+	key := metric + "\xff" + strings.Join(labels, "\xff")
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s, ok := r.series[key]
+	if !ok {
+		s = &counterState{namespace: namespace, last: math.NaN(), lastCount: math.NaN()}
+		r.series[key] = s
+	}
+	s.seen = true
+	if math.IsNaN(value) || math.IsNaN(count) {
+		return math.NaN()
+	}
+
+	avg := math.NaN()
+	if delta := count - s.lastCount; delta > 0 && value >= s.last {
+		avg = (value - s.last) / delta
+	}
+	s.last, s.lastCount = value, count
+	return avg
+}
+
+// fail records that namespace failed to scrape, so its series which were not
+// observed are kept by the next sweep.
+func (r *counterResets) fail(namespace string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.failed[namespace] = true
+}
+
+// sweep forgets the series which were not observed since the previous sweep,
+// so series which disappear do not pile up. The series of namespaces which
+// failed to scrape are kept.
+func (r *counterResets) sweep() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for key, s := range r.series {
+		if !s.seen && !r.failed[s.namespace] {
+			delete(r.series, key)
+			continue
+		}
+		s.seen = false
+	}
+	r.failed = make(map[string]bool)
+}
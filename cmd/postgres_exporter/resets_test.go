@@ -0,0 +1,129 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+type ResetsSuite struct{}
+
+var _ = Suite(&ResetsSuite{})
+
+func (s *ResetsSuite) TestObserve(c *C) {
+	r := newCounterResets()
+
+	c.Check(r.observe("ns", "m", []string{"a"}, 10), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 15), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 15), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 3), Equals, float64(1))
+	c.Check(r.observe("ns", "m", []string{"a"}, 2), Equals, float64(2))
+
+	// Series are tracked per metric and label set
+	c.Check(r.observe("ns", "m", []string{"b"}, 1), Equals, float64(0))
+	c.Check(r.observe("ns", "other", []string{"a"}, 1), Equals, float64(0))
+}
+
+func (s *ResetsSuite) TestObserveChange(c *C) {
+	r := newCounterResets()
+
+	c.Check(r.observeChange("ns", "m", []string{"a"}, 1600000000), Equals, float64(0))
+	c.Check(r.observeChange("ns", "m", []string{"a"}, 1600000000), Equals, float64(0))
+	c.Check(r.observeChange("ns", "m", []string{"a"}, 1700000000), Equals, float64(1))
+
+	// The first observation is not a change
+	c.Check(r.observeChange("ns", "m", []string{"b"}, 1700000000), Equals, float64(0))
+}
+
+func (s *ResetsSuite) TestAverage(c *C) {
+	r := newCounterResets()
+	average := func(value, count float64) float64 {
+		return r.average("ns", "m", []string{"a"}, value, count)
+	}
+
+	// Nothing to average over on the first scrape
+	c.Check(math.IsNaN(average(100, 10)), Equals, true)
+	c.Check(average(130, 12), Equals, float64(15))
+	// Nor without a checkpoint since the previous scrape
+	c.Check(math.IsNaN(average(130, 12)), Equals, true)
+	c.Check(average(230, 13), Equals, float64(100))
+
+	// A NULL is skipped
+	c.Check(math.IsNaN(average(math.NaN(), 14)), Equals, true)
+	c.Check(average(250, 15), Equals, float64(10))
+
+	// Nor across a reset of the statistics
+	c.Check(math.IsNaN(average(5, 1)), Equals, true)
+	c.Check(average(9, 3), Equals, float64(2))
+}
+
+func (s *ResetsSuite) TestSweep(c *C) {
+	r := newCounterResets()
+
+	r.observe("ns", "m", []string{"a"}, 10)
+	r.observe("ns", "m", []string{"a"}, 5)
+	r.observe("ns", "m", []string{"b"}, 10)
+	r.sweep()
+
+	r.observe("ns", "m", []string{"a"}, 1)
+	r.sweep()
+	c.Check(r.series, HasLen, 1)
+
+	// The series which was not observed was forgotten
+	c.Check(r.observe("ns", "m", []string{"b"}, 5), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 0), Equals, float64(3))
+}
+
+func (s *ResetsSuite) TestObserveNaN(c *C) {
+	r := newCounterResets()
+
+	// A NULL between two values is not a reset
+	c.Check(r.observe("ns", "m", []string{"a"}, 10), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 12), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 3), Equals, float64(1))
+
+	// Nor is a timestamp which reads NULL once
+	c.Check(r.observeChange("ns", "t", []string{"a"}, 1600000000), Equals, float64(0))
+	c.Check(r.observeChange("ns", "t", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observeChange("ns", "t", []string{"a"}, 1600000000), Equals, float64(0))
+}
+
+func (s *ResetsSuite) TestObserveStartingNull(c *C) {
+	r := newCounterResets()
+
+	// A counter which reads NULL at first is not reset by its first value
+	c.Check(r.observe("ns", "m", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 10), Equals, float64(0))
+	c.Check(r.observe("ns", "m", []string{"a"}, 3), Equals, float64(1))
+
+	// Nor is a timestamp which was never set by becoming set
+	c.Check(r.observeChange("ns", "t", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observeChange("ns", "t", []string{"a"}, math.NaN()), Equals, float64(0))
+	c.Check(r.observeChange("ns", "t", []string{"a"}, 1600000000), Equals, float64(0))
+	c.Check(r.observeChange("ns", "t", []string{"a"}, 1700000000), Equals, float64(1))
+}
+
+func (s *ResetsSuite) TestSweepFailedNamespace(c *C) {
+	r := newCounterResets()
+
+	r.observe("ns", "m", []string{"a"}, 10)
+	r.observe("ns", "m", []string{"a"}, 5)
+	r.observe("other", "m", []string{"a"}, 10)
+	r.sweep()
+
+	// The series of a namespace which failed to scrape are kept
+	r.fail("ns")
+	r.sweep()
+	c.Check(r.series, HasLen, 1)
+	c.Check(r.observe("ns", "m", []string{"a"}, 1), Equals, float64(2))
+
+	// Until a sweep after a scrape which succeeded
+	r.sweep()
+	r.sweep()
+	c.Check(r.series, HasLen, 0)
+}
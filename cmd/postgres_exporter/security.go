@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// securityEventsNamespace is the namespace of the security-events collector.
+const securityEventsNamespace = "pg_security"
+
+var securityEventsRelation = flag.String(
+	"security-events.relation", "security_events",
+	"Table or view, optionally schema qualified, the security-events collector reads its event and total columns from.",
+)
+
+// securityEventsQuery returns the query of the security-events collector for
+// the given table or view.
+func securityEventsQuery(relation string) (string, error) {
+	parts := strings.Split(relation, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid relation %q, must be name or schema.name", relation)
+	}
+	for i, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid relation %q, must be name or schema.name", relation)
+		}
+		parts[i] = quoteIdentifier(part)
+	}
+	return fmt.Sprintf("SELECT event::text AS event, total AS events_total FROM %s", strings.Join(parts, ".")), nil
+}
@@ -0,0 +1,27 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SecuritySuite struct{}
+
+var _ = Suite(&SecuritySuite{})
+
+func (s *SecuritySuite) TestSecurityEventsQuery(c *C) {
+	query, err := securityEventsQuery("security_events")
+	c.Assert(err, IsNil)
+	c.Check(query, Equals, `SELECT event::text AS event, total AS events_total FROM "security_events"`)
+
+	query, err = securityEventsQuery("monitoring.Login Failures")
+	c.Assert(err, IsNil)
+	c.Check(query, Equals, `SELECT event::text AS event, total AS events_total FROM "monitoring"."Login Failures"`)
+
+	for _, relation := range []string{"", "a.b.c", ".events", "monitoring."} {
+		_, err = securityEventsQuery(relation)
+		c.Check(err, ErrorMatches, "invalid relation.*", Commentf("relation %q", relation))
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"flag"
+)
+
+var sequenceExhaustionThreshold = flag.Float64(
+	"sequence-exhaustion.threshold", 0.5,
+	"Fraction of its range a sequence must have used to be reported by the sequence-exhaustion collector.",
+)
@@ -0,0 +1,342 @@
+// Copyright 2017 Percona LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The web server, basic authentication and landing page below are derived
+// from github.com/shatteredsilicon/exporter_shared, whose RunServer takes
+// neither a tls.Config nor extra handlers, and registers the same web.* flags.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	sslCertFile = flag.String(
+		"web.ssl-cert-file", "",
+		"Path to SSL certificate file. Reloaded on SIGHUP.",
+	)
+	sslKeyFile = flag.String(
+		"web.ssl-key-file", "",
+		"Path to SSL key file. Reloaded on SIGHUP.",
+	)
+	authFile = flag.String(
+		"web.auth-file", "",
+		"Path to YAML file with server_user, server_password keys for HTTP Basic authentication "+
+			"(overrides HTTP_AUTH environment variable).",
+	)
+	minScrapeInterval = flag.Duration(
+		"web.min-scrape-interval", 0,
+		"Reject scrapes arriving from the same client sooner than this after its previous scrape with 429 Too Many Requests. 0 disables the check.",
+	)
+
+	landingPage = template.Must(template.New("home").Parse(strings.TrimSpace(`
+<html>
+<head>
+	<title>{{ .name }} exporter</title>
+</head>
+<body>
+	<h1>{{ .name }} exporter</h1>
+	<p><a href="{{ .path }}">Metrics</a></p>
+</body>
+</html>
+`)))
+)
+
+// runServer runs the server for the exporter with the given name (used on
+// the landing page) on the given address, exposing metrics under the given
+// path and serving the extra handlers under theirs. It never returns.
+func runServer(name, addr, path string, gatherer prometheus.Gatherer, errorHandling promhttp.HandlerErrorHandling, extra map[string]http.Handler) {
+	certFile, keyFile := *sslCertFile, *sslKeyFile
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("One of the flags -web.ssl-cert-file or -web.ssl-key-file is missing to enable HTTPS.")
+	}
+	if certFile != "" {
+		if _, err := os.Stat(certFile); os.IsNotExist(err) {
+			log.Fatalf("SSL certificate file does not exist: %s", certFile)
+		}
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			log.Fatalf("SSL key file does not exist: %s", keyFile)
+		}
+	}
+
+	var buf bytes.Buffer
+	data := map[string]string{"name": name, "path": path}
+	if err := landingPage.Execute(&buf, data); err != nil {
+		log.Fatal(err)
+	}
+
+	handlers := map[string]http.Handler{
+		path: metricsHandler(gatherer, errorHandling, lookupConfig("web.min-scrape-interval", *minScrapeInterval).(time.Duration)),
+	}
+	for p, handler := range extra {
+		handlers[p] = handler
+	}
+
+	auth := readBasicAuth()
+	if auth.Username != "" && auth.Password != "" {
+		for p, handler := range handlers {
+			handlers[p] = &basicAuthHandler{basicAuth: *auth, handler: handler.ServeHTTP}
+		}
+		log.Infoln("HTTP Basic authentication is enabled.")
+	}
+
+	if certFile != "" {
+		runHTTPS(addr, path, certFile, keyFile, handlers, buf.Bytes())
+	} else {
+		runHTTP(addr, path, handlers, buf.Bytes())
+	}
+}
+
+func runHTTPS(addr, path, certFile, keyFile string, handlers map[string]http.Handler, landing []byte) {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reloader.reloadOnSIGHUP()
+
+	mux := http.NewServeMux()
+	for p, handler := range handlers {
+		mux.Handle(p, handler)
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		w.Write(landing) // nolint: errcheck
+	})
+
+	tlsCfg := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		},
+		GetCertificate: reloader.getCertificate,
+	}
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		TLSConfig:    tlsCfg,
+		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)), // disable HTTP/2
+	}
+	log.Infof("Starting HTTPS server for https://%s%s ...", addr, path)
+	// The certificate is served by GetCertificate, so no files are passed here.
+	log.Fatal(srv.ListenAndServeTLS("", ""))
+}
+
+func runHTTP(addr, path string, handlers map[string]http.Handler, landing []byte) {
+	mux := http.NewServeMux()
+	for p, handler := range handlers {
+		mux.Handle(p, handler)
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(landing) // nolint: errcheck
+	})
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	log.Infof("Starting HTTP server for http://%s%s ...", addr, path)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// certReloader serves a TLS certificate loaded from disk, and reloads it on
+// demand so rotated certificates are picked up without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mtx  sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the certificate and key files again. On error the previously
+// loaded certificate is kept.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	r.cert = &cert
+	r.mtx.Unlock()
+	return nil
+}
+
+func (r *certReloader) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := r.reload(); err != nil {
+			log.Errorln("Failed to reload SSL certificate, keeping the previous one:", err)
+			continue
+		}
+		log.Infoln("Reloaded SSL certificate", r.certFile)
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert, nil
+}
+
+// basicAuth combines username and password.
+type basicAuth struct {
+	Username string `yaml:"server_user,omitempty"`
+	Password string `yaml:"server_password,omitempty"`
+}
+
+// readBasicAuth returns basicAuth from the web.auth-file file, or the
+// HTTP_AUTH environment variable, or an empty one.
+func readBasicAuth() *basicAuth {
+	var auth basicAuth
+	httpAuth := os.Getenv("HTTP_AUTH")
+	switch {
+	case *authFile != "":
+		bytes, err := ioutil.ReadFile(*authFile)
+		if err != nil {
+			log.Fatalf("cannot read auth file %q: %s", *authFile, err)
+		}
+		if err = yaml.Unmarshal(bytes, &auth); err != nil {
+			log.Fatalf("cannot parse auth file %q: %s", *authFile, err)
+		}
+	case httpAuth != "":
+		data := strings.SplitN(httpAuth, ":", 2)
+		if len(data) != 2 || data[0] == "" || data[1] == "" {
+			log.Fatalf("HTTP_AUTH should be formatted as user:password")
+		}
+		auth.Username = data[0]
+		auth.Password = data[1]
+	}
+
+	return &auth
+}
+
+// basicAuthHandler checks username and password before invoking provided handler.
+type basicAuthHandler struct {
+	basicAuth
+	handler http.HandlerFunc
+}
+
+// ServeHTTP implements http.Handler.
+func (h *basicAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, _ := r.BasicAuth()
+	usernameOk := subtle.ConstantTimeCompare([]byte(h.Username), []byte(username)) == 1
+	passwordOk := subtle.ConstantTimeCompare([]byte(h.Password), []byte(password)) == 1
+	if !usernameOk || !passwordOk {
+		w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	h.handler(w, r)
+}
+
+// minIntervalHandler rejects requests from a client arriving sooner than
+// interval after its previous request, to protect the database from
+// misconfigured scrapers.
+type minIntervalHandler struct {
+	handler  http.Handler
+	interval time.Duration
+
+	mtx         sync.Mutex
+	lastScrapes map[string]time.Time
+}
+
+func newMinIntervalHandler(handler http.Handler, interval time.Duration) *minIntervalHandler {
+	return &minIntervalHandler{
+		handler:     handler,
+		interval:    interval,
+		lastScrapes: make(map[string]time.Time),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *minIntervalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	now := time.Now()
+	h.mtx.Lock()
+	last, found := h.lastScrapes[client]
+	if found && now.Sub(last) < h.interval {
+		h.mtx.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((h.interval - now.Sub(last)).Seconds()))))
+		http.Error(w, fmt.Sprintf("Scrapes are limited to one every %s", h.interval), http.StatusTooManyRequests)
+		return
+	}
+	// Forget clients which would not be rejected anymore anyway
+	for c, t := range h.lastScrapes {
+		if now.Sub(t) >= h.interval {
+			delete(h.lastScrapes, c)
+		}
+	}
+	h.lastScrapes[client] = now
+	h.mtx.Unlock()
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// metricsHandler returns the http.Handler for the given gatherer. HTTP Basic
+// authentication is added by runServer.
+func metricsHandler(gatherer prometheus.Gatherer, errorHandling promhttp.HandlerErrorHandling, minInterval time.Duration) http.Handler {
+	handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: errorHandling,
+	})
+
+	if minInterval > 0 {
+		handler = newMinIntervalHandler(handler, minInterval)
+		log.Infoln("Scrapes are limited to one every", minInterval, "per client.")
+	}
+
+	return handler
+}
@@ -0,0 +1,93 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ServerSuite struct{}
+
+var _ = Suite(&ServerSuite{})
+
+// writeCertificate writes a self-signed certificate for commonName and its
+// key to dir.
+func writeCertificate(c *C, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	c.Assert(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), IsNil)
+	return certFile, keyFile
+}
+
+func (s *ServerSuite) TestCertReloader(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := writeCertificate(c, dir, "first")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	c.Assert(err, IsNil)
+	commonName := func() string {
+		cert, err := reloader.getCertificate(nil)
+		c.Assert(err, IsNil)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		c.Assert(err, IsNil)
+		return parsed.Subject.CommonName
+	}
+	c.Check(commonName(), Equals, "first")
+
+	writeCertificate(c, dir, "second")
+	c.Assert(reloader.reload(), IsNil)
+	c.Check(commonName(), Equals, "second")
+
+	// A broken certificate is rejected and the previous one kept
+	c.Assert(ioutil.WriteFile(certFile, []byte("garbage"), 0600), IsNil)
+	c.Check(reloader.reload(), NotNil)
+	c.Check(commonName(), Equals, "second")
+}
+
+func (s *ServerSuite) TestMinIntervalHandler(c *C) {
+	handler := newMinIntervalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), time.Hour)
+	scrape := func(remoteAddr string) int {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	c.Check(scrape("192.0.2.1:1234"), Equals, http.StatusOK)
+	c.Check(scrape("192.0.2.1:1235"), Equals, http.StatusTooManyRequests)
+	c.Check(scrape("192.0.2.2:1234"), Equals, http.StatusOK)
+
+	// Pretend the interval has passed
+	handler.lastScrapes["192.0.2.1"] = time.Now().Add(-2 * time.Hour)
+	c.Check(scrape("192.0.2.1:1234"), Equals, http.StatusOK)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/log"
+)
+
+var (
+	sslCAInline = flag.String(
+		"db.ssl-ca-inline", "",
+		"PEM encoded CA certificates to verify the database server certificate with, instead of an sslrootcert file. Also settable with PG_EXPORTER_DB_SSL_CA_INLINE.",
+	)
+	sslUseSystemRoots = flag.Bool(
+		"db.ssl-use-system-roots", false,
+		"Verify the database server certificate with the system trust store, ignoring any sslrootcert of the DSN.",
+	)
+)
+
+// sslRootCert returns the sslrootcert to set in the DSNs according to the
+// flags, or nil to leave the DSNs alone. pgx only reads sslrootcert from a
+// file, so inline CA certificates are written to a temporary file, which the
+// caller removes with removeSSLRootCert; an empty sslrootcert makes pgx verify
+// with the system trust store.
+func sslRootCert() (*string, error) {
+	inline := lookupEnvConfig("db.ssl-ca-inline", "PG_EXPORTER_DB_SSL_CA_INLINE", *sslCAInline)
+	systemRoots := lookupConfig("db.ssl-use-system-roots", *sslUseSystemRoots).(bool)
+
+	switch {
+	case inline != "" && systemRoots:
+		return nil, errors.New("--db.ssl-ca-inline and --db.ssl-use-system-roots are mutually exclusive")
+	case systemRoots:
+		empty := ""
+		return &empty, nil
+	case inline != "":
+		path, err := writeSSLCA(inline)
+		if err != nil {
+			return nil, err
+		}
+		return &path, nil
+	}
+	return nil, nil
+}
+
+// writeSSLCA checks that pem holds at least one CA certificate and writes it
+// to a file in a temporary directory of its own, returning its path.
+func writeSSLCA(pem string) (string, error) {
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(pem)) {
+		return "", errors.New("--db.ssl-ca-inline does not contain any PEM encoded certificate")
+	}
+
+	dir, err := ioutil.TempDir("", "postgres_exporter-")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(path, []byte(pem), 0600); err != nil {
+		os.RemoveAll(dir) // nolint: errcheck
+		return "", err
+	}
+	return path, nil
+}
+
+// removeSSLRootCert removes the temporary directory of the sslrootcert
+// returned by sslRootCert, if it wrote one.
+func removeSSLRootCert(rootCert *string) {
+	if rootCert == nil || *rootCert == "" {
+		return
+	}
+	if err := os.RemoveAll(filepath.Dir(*rootCert)); err != nil {
+		log.Warnln("Failed to remove the temporary CA certificate:", err)
+	}
+}
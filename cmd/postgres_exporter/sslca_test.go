@@ -0,0 +1,62 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SSLCASuite struct{}
+
+var _ = Suite(&SSLCASuite{})
+
+func (s *SSLCASuite) TestWriteSSLCA(c *C) {
+	pem, err := ioutil.ReadFile("./tests/ca.pem")
+	c.Assert(err, IsNil)
+
+	path, err := writeSSLCA(string(pem))
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(filepath.Dir(path)) // nolint: errcheck
+
+	written, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(string(written), Equals, string(pem))
+
+	removeSSLRootCert(&path)
+	_, err = os.Stat(filepath.Dir(path))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// Nothing to remove without an inline CA
+	empty := ""
+	removeSSLRootCert(&empty)
+	removeSSLRootCert(nil)
+}
+
+func (s *SSLCASuite) TestSSLCAInlineEnvironment(c *C) {
+	c.Assert(os.Setenv("PG_EXPORTER_DB_SSL_CA_INLINE", "not a certificate"), IsNil)
+	defer UnsetEnvironment(c, "PG_EXPORTER_DB_SSL_CA_INLINE")
+
+	_, err := sslRootCert()
+	c.Check(err, ErrorMatches, ".*does not contain any PEM encoded certificate")
+}
+
+func (s *SSLCASuite) TestWriteSSLCAInvalid(c *C) {
+	_, err := writeSSLCA("not a certificate")
+	c.Check(err, ErrorMatches, ".*does not contain any PEM encoded certificate")
+}
+
+func (s *SSLCASuite) TestPrepareDSNSSLRootCert(c *C) {
+	path := "/tmp/ca.pem"
+	dsn, err := prepareDSN("host=localhost sslmode=verify-full", &path)
+	c.Assert(err, IsNil)
+	c.Check(dsn, Matches, `.* sslrootcert='/tmp/ca.pem'.*`)
+
+	dsn, err = prepareDSN("host=localhost sslmode=verify-full sslrootcert=/etc/ca.pem", nil)
+	c.Assert(err, IsNil)
+	c.Check(dsn, Matches, `.* sslrootcert=/etc/ca.pem.*`)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+var (
+	startupRetries = flag.Int64(
+		"startup-retries", 0,
+		"Times to retry connecting to the database at startup, before serving metrics, so a database starting alongside the exporter does not make pg_up flap. 0 does not wait.",
+	)
+	startupRetryInterval = flag.Duration(
+		"startup-retry-interval", time.Second,
+		"Wait before the first startup retry, doubled after each one.",
+	)
+)
+
+// loggableDSN returns dsn with the password blanked out, in either the URL or
+// the key/value form, if it can be parsed.
+func loggableDSN(dsn string) string {
+	if !isURLDSN(dsn) {
+		params, err := parseKeyValueDSN(dsn)
+		if err != nil {
+			return "could not parse DATA_SOURCE_NAME"
+		}
+		keys := make([]string, 0, len(params))
+		for key := range params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			value := params[key]
+			if key == "password" {
+				value = "PASSWORD_REMOVED"
+			}
+			parts = append(parts, key+"="+quoteDSNValue(value))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	pDsn, err := url.Parse(dsn)
+	if err != nil {
+		return "could not parse DATA_SOURCE_NAME"
+	}
+	// Blank user info if not nil
+	if pDsn.User != nil {
+		pDsn.User = url.UserPassword(pDsn.User.Username(), "PASSWORD_REMOVED")
+	}
+	// The password can also be given as a parameter
+	if q := pDsn.Query(); q.Get("password") != "" {
+		q.Set("password", "PASSWORD_REMOVED")
+		pDsn.RawQuery = q.Encode()
+	}
+	return pDsn.String()
+}
+
+// waitForDB connects to the database, retrying up to retries times with an
+// exponential backoff starting at interval. It returns the last error if no
+// attempt succeeded.
+func (e *Exporter) waitForDB(retries int64, interval time.Duration) error {
+	for attempt := int64(0); ; attempt++ {
+		_, err := e.getDB(e.dsn)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		log.Infof("Database (%s) not reachable at startup, retrying in %s (%d/%d): %s", loggableDSN(e.dsn), interval, attempt+1, retries, err)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	statStatementsDatabases = flag.String(
+		"stat-statements.databases", "",
+		"Comma separated databases to limit the stat-statements collector to. Empty collects all.",
+	)
+	statStatementsUsers = flag.String(
+		"stat-statements.users", "",
+		"Comma separated users to limit the stat-statements collector to. Empty collects all.",
+	)
+)
+
+// statStatementsFilter returns the condition limiting pg_stat_statements to
+// the given databases and users, or "" if both lists are empty.
+func statStatementsFilter(databases, users string) (string, error) {
+	var conditions []string
+	for _, filter := range []struct{ column, list string }{
+		{"datname", databases},
+		{"usename", users},
+	} {
+		if strings.TrimSpace(filter.list) == "" {
+			continue
+		}
+
+		var values []string
+		for _, name := range strings.Split(filter.list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return "", fmt.Errorf("empty name in %s list %q", filter.column, filter.list)
+			}
+			values = append(values, quoteLiteral(name))
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", filter.column, strings.Join(values, ", ")))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// quoteLiteral quotes s as a SQL string literal.
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `'`, `''`, -1)
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.Replace(s, `\`, `\\`, -1) + `'`
+	}
+	return `'` + s + `'`
+}
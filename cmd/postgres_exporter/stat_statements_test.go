@@ -0,0 +1,29 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type StatStatementsSuite struct{}
+
+var _ = Suite(&StatStatementsSuite{})
+
+func (s *StatStatementsSuite) TestStatStatementsFilter(c *C) {
+	filter, err := statStatementsFilter("", "")
+	c.Assert(err, IsNil)
+	c.Check(filter, Equals, "")
+
+	filter, err = statStatementsFilter("app, billing", "")
+	c.Assert(err, IsNil)
+	c.Check(filter, Equals, "datname IN ('app', 'billing')")
+
+	filter, err = statStatementsFilter("app", `o'brien,back\slash`)
+	c.Assert(err, IsNil)
+	c.Check(filter, Equals, `datname IN ('app') AND usename IN ('o''brien', E'back\\slash')`)
+
+	_, err = statStatementsFilter("app,,billing", "")
+	c.Check(err, ErrorMatches, `empty name in datname list "app,,billing"`)
+}
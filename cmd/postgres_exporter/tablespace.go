@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	tablespacePaths = flag.String(
+		"collect.tablespace-free-paths", "",
+		"Comma separated tablespace=path pairs, report the free space of the filesystem of each path. Only works when the exporter runs on the database host.",
+	)
+
+	tablespaceFreeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "tablespace", "free_bytes"),
+		"Free space available to unprivileged users on the filesystem of the tablespace, in bytes.",
+		[]string{"tablespace"}, nil,
+	)
+)
+
+// parseTablespacePaths parses comma separated tablespace=path pairs.
+func parseTablespacePaths(s string) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("invalid tablespace path %q, must be tablespace=path", pair)
+		}
+		paths[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return paths, nil
+}
+
+// queryTablespaceFree reports the free space of the filesystem of each
+// tablespace path. It does not need a database connection, so a full disk
+// is reported even if it brought the database down.
+func queryTablespaceFree(ch chan<- prometheus.Metric, paths map[string]string) error {
+	var failed []string
+	for tablespace, path := range paths {
+		free, err := freeBytes(path)
+		if err != nil {
+			log.Infof("Error reading free space of tablespace %s (%s): %s", tablespace, path, err)
+			failed = append(failed, tablespace)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(tablespaceFreeDesc, prometheus.GaugeValue, free, tablespace)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not read free space of tablespaces: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
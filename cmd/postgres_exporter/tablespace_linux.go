@@ -0,0 +1,15 @@
+package main
+
+import (
+	"syscall"
+)
+
+// freeBytes returns the space available to unprivileged users on the
+// filesystem of path.
+func freeBytes(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return float64(st.Bavail) * float64(st.Bsize), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// freeBytes is only implemented on Linux.
+func freeBytes(path string) (float64, error) {
+	return 0, errors.New("tablespace free space is only supported on Linux")
+}
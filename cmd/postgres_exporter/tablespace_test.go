@@ -0,0 +1,28 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type TablespaceSuite struct{}
+
+var _ = Suite(&TablespaceSuite{})
+
+func (s *TablespaceSuite) TestParseTablespacePaths(c *C) {
+	paths, err := parseTablespacePaths("pg_default=/var/lib/postgresql, fast = /mnt/fast,")
+	c.Assert(err, IsNil)
+	c.Check(paths, DeepEquals, map[string]string{
+		"pg_default": "/var/lib/postgresql",
+		"fast":       "/mnt/fast",
+	})
+
+	paths, err = parseTablespacePaths("")
+	c.Assert(err, IsNil)
+	c.Check(paths, HasLen, 0)
+
+	_, err = parseTablespacePaths("pg_default")
+	c.Check(err, ErrorMatches, `invalid tablespace path "pg_default", must be tablespace=path`)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+var telemetryPathByTag = flag.Bool(
+	"web.telemetry-path-by-tag", false,
+	"Serve the metrics of the custom queries carrying a tag under <web.telemetry-path>/<tag>.",
+)
+
+// tagRegex matches the tags of custom queries, which are used in URL paths.
+var tagRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// parseTags parses the tags of a custom query namespace.
+func parseTags(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("tags must be a list")
+	}
+
+	tags := make([]string, 0, len(list))
+	for _, t := range list {
+		tag := fmt.Sprint(t)
+		if !tagRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// hasTag returns whether the namespace carries tag.
+func (m MetricMapNamespace) hasTag(tag string) bool {
+	for _, t := range m.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// taggedCollector collects the metrics of the namespaces of exporter carrying
+// tag, along with pg_up and the version of the server. The exporter's own
+// scrape metrics only cover the scrapes of all metrics.
+type taggedCollector struct {
+	exporter *Exporter
+	tag      string
+}
+
+// Describe implements prometheus.Collector.
+func (c taggedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.exporter.psqlUp.Desc()
+	ch <- userQuerySuccessDesc
+	ch <- namespaceScrapeDurationDesc
+	ch <- namespaceScrapeErrorDesc
+	ch <- namespaceRowsScannedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c taggedCollector) Collect(ch chan<- prometheus.Metric) {
+	e := c.exporter
+
+	db, err := e.getDB(e.dsn)
+	if err != nil {
+		log.Infoln("Error opening connection to database for tag", c.tag+":", err)
+		ch <- prometheus.MustNewConstMetric(e.psqlUp.Desc(), prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(e.psqlUp.Desc(), prometheus.GaugeValue, 1)
+
+	if err := e.checkMapVersions(ch, db); err != nil {
+		log.Warnln("Proceeding with outdated query maps, as the Postgres version could not be determined:", err)
+	}
+
+	e.mappingMtx.RLock()
+	defer e.mappingMtx.RUnlock()
+
+	// Canceled when the scrape returns, stopping any query still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e.queryNamespaceMappings(ctx, ch, db, e.getReplicaDB(), c.tag)
+}
+
+// tagHandler serves the metrics of the namespaces carrying the tag which is
+// the last element of the request path.
+type tagHandler struct {
+	exporter   *Exporter
+	prefix     string
+	rules      []relabelRule
+	helpSuffix string
+}
+
+// ServeHTTP implements http.Handler.
+func (h *tagHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tag := strings.TrimPrefix(r.URL.Path, h.prefix)
+	if !tagRegex.MatchString(tag) {
+		http.NotFound(w, r)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(taggedCollector{exporter: h.exporter, tag: tag})
+	gatherer := helpSuffixGatherer{
+		gatherer: relabelGatherer{gatherer: registry, rules: h.rules},
+		suffix:   h.helpSuffix,
+	}
+	promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
@@ -0,0 +1,64 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/blang/semver"
+	. "gopkg.in/check.v1"
+)
+
+type TagsSuite struct{}
+
+var _ = Suite(&TagsSuite{})
+
+func (s *TagsSuite) TestAddQueriesTags(c *C) {
+	content := []byte(`
+orders:
+  query: "SELECT count(*) AS total FROM orders"
+  tags: [team-a, billing]
+  metrics:
+    - total:
+        usage: "GAUGE"
+        description: "Orders"
+`)
+
+	exporterMap := make(map[string]MetricMapNamespace)
+	err := addQueries(content, semver.MustParse("10.0.0"), exporterMap, make(map[string]string), userQueriesReplace)
+	c.Assert(err, IsNil)
+	c.Check(exporterMap["orders"].tags, DeepEquals, []string{"team-a", "billing"})
+	c.Check(exporterMap["orders"].hasTag("billing"), Equals, true)
+	c.Check(exporterMap["orders"].hasTag("team-b"), Equals, false)
+}
+
+func (s *TagsSuite) TestParseTagsInvalid(c *C) {
+	_, err := parseTags("team-a")
+	c.Check(err, ErrorMatches, `tags must be a list`)
+
+	_, err = parseTags([]interface{}{"team-a", "team/b"})
+	c.Check(err, ErrorMatches, `invalid tag "team/b"`)
+}
+
+func (s *TagsSuite) TestTagHandler(c *C) {
+	h := &tagHandler{
+		exporter: NewExporter("host=127.0.0.1 port=1 sslmode=disable"),
+		prefix:   "/metrics/",
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	c.Check(get("/metrics/").Code, Equals, http.StatusNotFound)
+	c.Check(get("/metrics/team-a/orders").Code, Equals, http.StatusNotFound)
+
+	// Nothing listens on the port
+	w := get("/metrics/team-a")
+	c.Check(w.Code, Equals, http.StatusOK)
+	c.Check(strings.Contains(w.Body.String(), "\npg_up 0\n"), Equals, true, Commentf("body:\n%s", w.Body.String()))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var userTablesExcludeSchemas = flag.String(
+	"user-tables.exclude-schemas", "",
+	"Comma separated schemas whose tables the user-tables collector leaves out.",
+)
+
+// userTablesFilter returns the condition leaving the tables of the given
+// schemas out of pg_stat_user_tables, or "" if the list is empty.
+func userTablesFilter(schemas string) (string, error) {
+	if strings.TrimSpace(schemas) == "" {
+		return "", nil
+	}
+
+	var values []string
+	for _, name := range strings.Split(schemas, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return "", fmt.Errorf("empty name in schema list %q", schemas)
+		}
+		values = append(values, quoteLiteral(name))
+	}
+	return fmt.Sprintf("schemaname NOT IN (%s)", strings.Join(values, ", ")), nil
+}
@@ -0,0 +1,25 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type UserTablesSuite struct{}
+
+var _ = Suite(&UserTablesSuite{})
+
+func (s *UserTablesSuite) TestUserTablesFilter(c *C) {
+	filter, err := userTablesFilter(" ")
+	c.Assert(err, IsNil)
+	c.Check(filter, Equals, "")
+
+	filter, err = userTablesFilter("pg_catalog, information_schema,o'brien")
+	c.Assert(err, IsNil)
+	c.Check(filter, Equals, "schemaname NOT IN ('pg_catalog', 'information_schema', 'o''brien')")
+
+	_, err = userTablesFilter("pg_catalog,,audit")
+	c.Check(err, ErrorMatches, `empty name in schema list "pg_catalog,,audit"`)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// listFlag is a string flag which can be repeated, its values are joined with
+// commas. Being a string underneath it is looked up like any other string
+// flag.
+type listFlag string
+
+func (f *listFlag) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value.
+func (f *listFlag) Set(value string) error {
+	if *f != "" {
+		value = string(*f) + "," + value
+	}
+	*f = listFlag(value)
+	return nil
+}
+
+var (
+	forceGauge   listFlag
+	forceCounter listFlag
+)
+
+func init() {
+	flag.Var(&forceGauge, "force-gauge", "namespace.column of a builtin or collector metric to export as a gauge. Repeatable, or comma separated.")
+	flag.Var(&forceCounter, "force-counter", "namespace.column of a builtin or collector metric to export as a counter. Repeatable, or comma separated.")
+}
+
+// parseForcedUsages parses the comma separated namespace.column lists of the
+// columns to export as gauges and as counters, and checks that each column
+// is a known counter or gauge.
+func parseForcedUsages(gauges, counters string, metricMaps map[string]map[string]ColumnMapping) (map[string]ColumnUsage, error) {
+	usages := make(map[string]ColumnUsage)
+	for _, list := range []struct {
+		flag  string
+		value string
+		usage ColumnUsage
+	}{
+		{"force-gauge", gauges, GAUGE},
+		{"force-counter", counters, COUNTER},
+	} {
+		for _, column := range strings.Split(list.value, ",") {
+			column = strings.TrimSpace(column)
+			if column == "" {
+				continue
+			}
+
+			i := strings.LastIndex(column, ".")
+			if i <= 0 || i == len(column)-1 {
+				return nil, fmt.Errorf("invalid --%s %q, must be namespace.column", list.flag, column)
+			}
+			mapping, ok := metricMaps[column[:i]][column[i+1:]]
+			if !ok {
+				return nil, fmt.Errorf("invalid --%s %q, no such column", list.flag, column)
+			}
+			if mapping.usage != COUNTER && mapping.usage != GAUGE {
+				return nil, fmt.Errorf("invalid --%s %q, only counters and gauges can be forced", list.flag, column)
+			}
+			if usage, ok := usages[column]; ok && usage != list.usage {
+				return nil, fmt.Errorf("%q is forced to be both a gauge and a counter", column)
+			}
+			usages[column] = list.usage
+		}
+	}
+	return usages, nil
+}
@@ -0,0 +1,58 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"github.com/blang/semver"
+	"github.com/prometheus/client_golang/prometheus"
+	. "gopkg.in/check.v1"
+)
+
+type ValueTypeSuite struct{}
+
+var _ = Suite(&ValueTypeSuite{})
+
+func (s *ValueTypeSuite) TestListFlag(c *C) {
+	var f listFlag
+	c.Assert(f.Set("pg_stat_database.numbackends"), IsNil)
+	c.Assert(f.Set("pg_stat_database.deadlocks"), IsNil)
+	c.Check(f.String(), Equals, "pg_stat_database.numbackends,pg_stat_database.deadlocks")
+}
+
+func (s *ValueTypeSuite) TestParseForcedUsages(c *C) {
+	usages, err := parseForcedUsages("pg_stat_database.deadlocks", "pg_stat_database.numbackends, pg_stat_activity.count", knownMetricMaps(""))
+	c.Assert(err, IsNil)
+	c.Check(usages, DeepEquals, map[string]ColumnUsage{
+		"pg_stat_database.deadlocks":   GAUGE,
+		"pg_stat_database.numbackends": COUNTER,
+		"pg_stat_activity.count":       COUNTER,
+	})
+
+	for _, t := range []struct {
+		gauges, counters, err string
+	}{
+		{"deadlocks", "", `invalid --force-gauge "deadlocks", must be namespace.column`},
+		{"", "pg_stat_database.", `invalid --force-counter "pg_stat_database.", must be namespace.column`},
+		{"pg_stat_database.unknown", "", `invalid --force-gauge "pg_stat_database.unknown", no such column`},
+		{"pg_stat_database.datname", "", `.*only counters and gauges can be forced`},
+		{"pg_stat_database.deadlocks", "pg_stat_database.deadlocks", `.*forced to be both a gauge and a counter`},
+	} {
+		_, err := parseForcedUsages(t.gauges, t.counters, knownMetricMaps(""))
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *ValueTypeSuite) TestMakeDescMapForcedUsages(c *C) {
+	metricMaps := map[string]map[string]ColumnMapping{
+		"pg_stat_database": {
+			"numbackends": {GAUGE, "Backends", nil, nil},
+			"deadlocks":   {COUNTER, "Deadlocks", nil, nil},
+		},
+	}
+	descMap := makeDescMap(semver.MustParse("10.0.0"), metricMaps, descMapOptions{
+		usages: map[string]ColumnUsage{"pg_stat_database.deadlocks": GAUGE},
+	})
+	c.Check(descMap["pg_stat_database"].columnMappings["numbackends"].vtype, Equals, prometheus.GaugeValue)
+	c.Check(descMap["pg_stat_database"].columnMappings["deadlocks"].vtype, Equals, prometheus.GaugeValue)
+}